@@ -0,0 +1,169 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"gorm.io/gorm"
+)
+
+// Error codes used in the error envelope.
+const (
+	CodeBadRequest         = "bad_request"
+	CodeUnauthorized       = "unauthorized"
+	CodeForbidden          = "forbidden"
+	CodeNotFound           = "not_found"
+	CodeConflict           = "conflict"
+	CodePreconditionFailed = "precondition_failed"
+	CodeValidationFailed   = "validation_failed"
+	CodeInternal           = "internal_error"
+)
+
+// Error is an API error that is rendered as a JSON envelope by Handler.
+type Error struct {
+	// Status is the HTTP status code of the response.
+	Status int `json:"-"`
+	// Code is a stable, machine-readable error code.
+	Code string `json:"code"`
+	// Message is a human-readable description of the error.
+	Message string `json:"message"`
+	// Fields holds per-field messages for validation errors.
+	Fields map[string]string `json:"fields,omitempty"`
+	// RequestId identifies the request in the server logs.
+	RequestId string `json:"request_id,omitempty"`
+	// Err is the underlying cause. It is logged but never rendered.
+	Err error `json:"-"`
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the underlying cause.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New creates an API error with the given status, code and message.
+func New(status int, code string, message string) *Error {
+	return &Error{
+		Status:  status,
+		Code:    code,
+		Message: message,
+	}
+}
+
+// BadRequest returns a 400 error for malformed requests.
+func BadRequest(message string) *Error {
+	return New(fiber.StatusBadRequest, CodeBadRequest, message)
+}
+
+// Unauthorized returns a 401 error for missing or invalid credentials.
+func Unauthorized(message string) *Error {
+	return New(fiber.StatusUnauthorized, CodeUnauthorized, message)
+}
+
+// Forbidden returns a 403 error for authenticated users that lack a permission.
+func Forbidden(message string) *Error {
+	return New(fiber.StatusForbidden, CodeForbidden, message)
+}
+
+// NotFound returns a 404 error for missing resources.
+func NotFound(message string) *Error {
+	return New(fiber.StatusNotFound, CodeNotFound, message)
+}
+
+// Conflict returns a 409 error for requests that conflict with the current state.
+func Conflict(message string) *Error {
+	return New(fiber.StatusConflict, CodeConflict, message)
+}
+
+// PreconditionFailed returns a 412 error for requests whose preconditions do not hold.
+func PreconditionFailed(message string) *Error {
+	return New(fiber.StatusPreconditionFailed, CodePreconditionFailed, message)
+}
+
+// Validation returns a 422 error with a message for each invalid field.
+func Validation(fields map[string]string) *Error {
+	err := New(fiber.StatusUnprocessableEntity, CodeValidationFailed, "validation failed")
+	err.Fields = fields
+	return err
+}
+
+// Internal returns a 500 error that hides the underlying cause from the client.
+func Internal(cause error) *Error {
+	err := New(fiber.StatusInternalServerError, CodeInternal, "internal server error")
+	err.Err = cause
+	return err
+}
+
+// Handler is the Fiber error handler. It converts any error returned by a handler
+// or middleware into the JSON error envelope with the matching status code.
+// Errors that are not API errors are logged and reported as 500s.
+func Handler(context *fiber.Ctx, err error) error {
+	apiErr := From(err)
+	if requestId, ok := context.Locals(requestid.ConfigDefault.ContextKey).(string); ok {
+		apiErr.RequestId = requestId
+	}
+	if apiErr.Status >= fiber.StatusInternalServerError {
+		log.Printf("request %s %s %s failed: %v", apiErr.RequestId, context.Method(), context.Path(), err)
+	}
+	return context.Status(apiErr.Status).JSON(apiErr)
+}
+
+// From converts any error into an API error.
+// The returned error is a copy, so it is safe to modify.
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		clone := *apiErr
+		return &clone
+	}
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return fromStatus(fiberErr.Code, fiberErr.Message)
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return BadRequest("malformed JSON body")
+	case errors.As(err, &typeErr):
+		return BadRequest("invalid type for field " + typeErr.Field)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return NotFound("resource not found")
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return Conflict("resource already exists")
+	case errors.Is(err, gorm.ErrForeignKeyViolated):
+		return Conflict("resource is referenced by other records")
+	}
+	return Internal(err)
+}
+
+// fromStatus maps a plain HTTP status, as produced by Fiber itself, onto an API error.
+func fromStatus(status int, message string) *Error {
+	switch status {
+	case fiber.StatusBadRequest:
+		return BadRequest(message)
+	case fiber.StatusUnauthorized:
+		return Unauthorized(message)
+	case fiber.StatusForbidden:
+		return Forbidden(message)
+	case fiber.StatusNotFound:
+		return NotFound(message)
+	case fiber.StatusConflict:
+		return Conflict(message)
+	case fiber.StatusPreconditionFailed:
+		return PreconditionFailed(message)
+	case fiber.StatusUnprocessableEntity:
+		return New(status, CodeValidationFailed, message)
+	}
+	if status >= fiber.StatusInternalServerError {
+		return Internal(errors.New(message))
+	}
+	return New(status, CodeBadRequest, message)
+}
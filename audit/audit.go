@@ -0,0 +1,152 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/lemadane/admin_backend_gofiber/models"
+	"github.com/lemadane/admin_backend_gofiber/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// changeKey is the key of the request local that holds what a handler reported about its change.
+const changeKey = "audit.change"
+
+// change is what a handler reported about the change made by a request, for RecordRequest.
+type change struct {
+	targetType string
+	targetId   uint
+	before     interface{}
+	after      interface{}
+	// recorded holds the actions that the handler already recorded itself.
+	recorded map[string]bool
+}
+
+// Record writes an audit log entry for a change made by the user of the request.
+// The actor is taken from the request's access token, and before and after are stored as JSON;
+// either may be nil, e.g. when an entity is created or deleted.
+// It should be called with the transaction that makes the change, so that the change and
+// its audit entry are committed together. RecordRequest does not record the action again.
+func Record(tx *gorm.DB, context *fiber.Ctx, action string, targetType string, targetId uint, before interface{}, after interface{}) error {
+	entry := models.AuditLog{
+		ActorId:    actorId(context),
+		Action:     action,
+		TargetType: targetType,
+		TargetId:   targetId,
+		Ip:         context.IP(),
+		UserAgent:  context.Get(fiber.HeaderUserAgent),
+	}
+	var err error
+	if entry.Before, err = encode(before); err != nil {
+		return err
+	}
+	if entry.After, err = encode(after); err != nil {
+		return err
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return err
+	}
+	current(context).recorded[action] = true
+	return nil
+}
+
+// Target sets the entity changed by the request, for requests whose route has no :id parameter
+// naming it or whose route name does not start with its type.
+func Target(context *fiber.Ctx, targetType string, targetId uint) {
+	change := current(context)
+	change.targetType = targetType
+	change.targetId = targetId
+}
+
+// Before sets the state of the changed entity before the request, as it should appear in the audit log.
+func Before(context *fiber.Ctx, v interface{}) {
+	current(context).before = v
+}
+
+// After sets the state of the changed entity after the request, as it should appear in the audit log.
+func After(context *fiber.Ctx, v interface{}) {
+	current(context).after = v
+}
+
+// RecordRequest writes the audit log entry for a request that succeeded, under action.
+// The target is the one set with Target, or else the type that action starts with, as in
+// "users.update", and the ID in the :id route parameter. When both the state before and
+// after the change were set, only the fields that changed are stored.
+// Nothing is written if the handler already recorded the action with Record.
+func RecordRequest(tx *gorm.DB, context *fiber.Ctx, action string) error {
+	change := current(context)
+	if change.recorded[action] {
+		return nil
+	}
+	targetType, targetId := change.targetType, change.targetId
+	if targetType == "" {
+		targetType, _, _ = strings.Cut(action, ".")
+		if id, err := strconv.ParseUint(context.Params("id"), 10, 32); err == nil {
+			targetId = uint(id)
+		}
+	}
+	before, after := diff(change.before, change.after)
+	return Record(tx, context, action, targetType, targetId, before, after)
+}
+
+// current returns what the handler reported about the change made by the request so far.
+func current(context *fiber.Ctx) *change {
+	c, ok := context.Locals(changeKey).(*change)
+	if !ok {
+		c = &change{recorded: map[string]bool{}}
+		context.Locals(changeKey, c)
+	}
+	return c
+}
+
+// diff returns the fields of before and after whose JSON encodings differ, if both encode to
+// JSON objects. Otherwise it returns them unchanged.
+func diff(before interface{}, after interface{}) (interface{}, interface{}) {
+	if before == nil || after == nil {
+		return before, after
+	}
+	var changedBefore, changedAfter map[string]json.RawMessage
+	if reencode(before, &changedBefore) != nil || reencode(after, &changedAfter) != nil {
+		return before, after
+	}
+	for field, value := range changedBefore {
+		if next, ok := changedAfter[field]; ok && bytes.Equal(value, next) {
+			delete(changedBefore, field)
+			delete(changedAfter, field)
+		}
+	}
+	return changedBefore, changedAfter
+}
+
+// reencode decodes the JSON encoding of v into target.
+func reencode(v interface{}, target interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+// actorId returns the ID of the user who sent the request, or zero if it is not authenticated.
+// It reads the claims of the token verified by middlewares.IsAuthenticated, which the audit middleware
+// runs after.
+func actorId(context *fiber.Ctx) uint {
+	claims := utils.RequestClaims(context)
+	if claims == nil {
+		return 0
+	}
+	id, _ := claims.UserId()
+	return id
+}
+
+// encode returns the JSON encoding of v, or an empty document for nil.
+func encode(v interface{}) (models.JSON, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
@@ -0,0 +1,159 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lemadane/admin_backend_gofiber/db"
+	"github.com/lemadane/admin_backend_gofiber/internal/testdb"
+	"github.com/lemadane/admin_backend_gofiber/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestDiff(t *testing.T) {
+	type role struct {
+		Name  string `json:"name"`
+		Level uint   `json:"level"`
+	}
+	tests := []struct {
+		name   string
+		before interface{}
+		after  interface{}
+		// wantBefore and wantAfter are the JSON encodings of the result.
+		wantBefore string
+		wantAfter  string
+	}{
+		{
+			name:       "changed field",
+			before:     role{Name: "Clerk", Level: 1},
+			after:      role{Name: "Clerk", Level: 2},
+			wantBefore: `{"level":1}`,
+			wantAfter:  `{"level":2}`,
+		},
+		{
+			name:       "added and removed fields",
+			before:     map[string]interface{}{"name": "Clerk", "parent_id": 1},
+			after:      map[string]interface{}{"name": "Clerk", "level": 2},
+			wantBefore: `{"parent_id":1}`,
+			wantAfter:  `{"level":2}`,
+		},
+		{
+			name:       "nested value",
+			before:     map[string]interface{}{"roles": []uint{1}, "name": "Ada"},
+			after:      map[string]interface{}{"roles": []uint{1, 2}, "name": "Ada"},
+			wantBefore: `{"roles":[1]}`,
+			wantAfter:  `{"roles":[1,2]}`,
+		},
+		{
+			name:       "nothing changed",
+			before:     role{Name: "Clerk"},
+			after:      role{Name: "Clerk"},
+			wantBefore: `{}`,
+			wantAfter:  `{}`,
+		},
+		{
+			name:       "created",
+			before:     nil,
+			after:      role{Name: "Clerk"},
+			wantBefore: `null`,
+			wantAfter:  `{"name":"Clerk","level":0}`,
+		},
+		{
+			name:       "not objects",
+			before:     []uint{1},
+			after:      []uint{1, 2},
+			wantBefore: `[1]`,
+			wantAfter:  `[1,2]`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before, after := diff(test.before, test.after)
+			for _, side := range []struct {
+				name string
+				got  interface{}
+				want string
+			}{
+				{"before", before, test.wantBefore},
+				{"after", after, test.wantAfter},
+			} {
+				data, err := json.Marshal(side.got)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != side.want {
+					t.Errorf("%s = %s, want %s", side.name, data, side.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRecordRequest(t *testing.T) {
+	// entry is an expected entry: its action and the JSON encoding of its state before the change.
+	// The handler records no state before the change, while the request records the changed fields.
+	type entry struct {
+		action string
+		before string
+	}
+	tests := []struct {
+		name string
+		// recorded are the actions that the handler records itself.
+		recorded []string
+		// want are the entries written, in order.
+		want []entry
+	}{
+		{name: "recorded by the request only", want: []entry{{"roles.update", `{"level":1}`}}},
+		{name: "recorded by the handler", recorded: []string{"roles.update"}, want: []entry{{"roles.update", ""}}},
+		{
+			name:     "other action recorded by the handler",
+			recorded: []string{"users.roles.reassign"},
+			want:     []entry{{"users.roles.reassign", ""}, {"roles.update", `{"level":1}`}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testdb.Setup(t)
+			app := fiber.New()
+			app.Put("/roles/:id", func(context *fiber.Ctx) error {
+				for _, action := range test.recorded {
+					if err := Record(db.Session(), context, action, "roles", 7, nil, fiber.Map{"level": 2}); err != nil {
+						return err
+					}
+				}
+				Before(context, fiber.Map{"name": "Clerk", "level": 1})
+				After(context, fiber.Map{"name": "Clerk", "level": 2})
+				return RecordRequest(db.Session(), context, "roles.update")
+			})
+			response, err := app.Test(httptest.NewRequest(fiber.MethodPut, "/roles/7", nil), -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.StatusCode != fiber.StatusOK {
+				t.Fatalf("status %d", response.StatusCode)
+			}
+
+			var entries []models.AuditLog
+			if err := db.Session().Order("id").Find(&entries).Error; err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != len(test.want) {
+				t.Fatalf("%d entries, want %d", len(entries), len(test.want))
+			}
+			for i, entry := range entries {
+				want := test.want[i]
+				if entry.Action != want.action || entry.TargetType != "roles" || entry.TargetId != 7 {
+					t.Errorf("entry %d = %s of %s %d, want %s of roles 7", i, entry.Action, entry.TargetType, entry.TargetId, want.action)
+				}
+				if string(entry.Before) != want.before {
+					t.Errorf("entry %d before = %s, want %s", i, entry.Before, want.before)
+				}
+				if string(entry.After) != `{"level":2}` {
+					t.Errorf("entry %d after = %s, want %s", i, entry.After, `{"level":2}`)
+				}
+			}
+		})
+	}
+}
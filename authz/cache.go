@@ -0,0 +1,227 @@
+package authz
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lemadane/admin_backend_gofiber/db"
+	"github.com/lemadane/admin_backend_gofiber/models"
+	"github.com/lemadane/admin_backend_gofiber/ttlmap"
+
+	"gorm.io/gorm"
+)
+
+// CacheTTL bounds how long a role's permissions and a user's roles are served from memory.
+// Changes made through this process invalidate the cache immediately;
+// the TTL only matters for changes made by other instances.
+const CacheTTL = time.Minute
+
+// Subject identifies who is being authorized, as described by the claims of an access token.
+type Subject struct {
+	UserId uint
+	// RoleIds are the user's roles when the token was issued, and PermissionsVersion the sum of
+	// their permissions versions. Since versions only grow, the sum grows whenever any of the
+	// roles changes. The token's roles are not trusted to be still assigned to the user; they only
+	// tell which roles the version describes.
+	RoleIds            []uint
+	PermissionsVersion uint
+}
+
+// entry is a cached permission set of one role.
+type entry struct {
+	grants   Grants
+	version  uint
+	loadedAt time.Time
+}
+
+var (
+	mu sync.RWMutex
+	// roles caches permission sets keyed by role ID.
+	roles = map[uint]entry{}
+	// users caches the IDs of the roles assigned to users, keyed by user ID.
+	users = ttlmap.New[uint, []uint](CacheTTL)
+)
+
+// Permissions returns the permissions granted to the subject: the union of the permissions of
+// all of the user's current roles.
+// When the user's roles and their permissions have fresh cache entries, and those entries are at
+// least as new as the token's permissions version, no database query is made. Otherwise the
+// user's roles are read from user_roles, and the permissions of the roles, including those
+// inherited from the roles' ancestors, are loaded and cached.
+func Permissions(subject Subject) (Grants, error) {
+	roleIds, err := currentRoles(subject.UserId)
+	if err != nil {
+		return nil, err
+	}
+	// The token's version is the sum over the roles it was issued with, so it says nothing
+	// about the cache entries of other roles.
+	var version uint
+	if sameRoles(roleIds, subject.RoleIds) {
+		version = subject.PermissionsVersion
+	}
+	if grants, ok := cached(roleIds, version); ok {
+		return grants, nil
+	}
+	return loadAll(roleIds)
+}
+
+// currentRoles returns the IDs of the roles assigned to the user, from the cache if it holds a
+// fresh entry and from user_roles otherwise. A user that does not exist holds no roles.
+func currentRoles(userId uint) ([]uint, error) {
+	if roleIds, ok := users.Get(userId); ok {
+		return roleIds, nil
+	}
+	roleIds := make([]uint, 0)
+	err := db.Session().Model(&models.UserRole{}).Where("user_id = ?", userId).Order("role_id").Pluck("role_id", &roleIds).Error
+	if err != nil {
+		return nil, err
+	}
+	users.Set(userId, roleIds)
+	return roleIds, nil
+}
+
+// sameRoles reports whether a and b hold the same role IDs, in any order.
+func sameRoles(a []uint, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	held := make(map[uint]bool, len(a))
+	for _, roleId := range a {
+		held[roleId] = true
+	}
+	for _, roleId := range b {
+		if !held[roleId] {
+			return false
+		}
+	}
+	return true
+}
+
+// Snapshot returns the IDs of the user's current roles and the sum of their permissions
+// versions, to be embedded in a newly issued access token.
+func Snapshot(userId uint) ([]uint, uint, error) {
+	var user models.User
+	if err := db.Session().Preload("Roles").First(&user, userId).Error; err != nil {
+		return nil, 0, err
+	}
+	var version uint
+	for _, role := range user.Roles {
+		version += role.PermissionsVersion
+	}
+	return user.RoleIds(), version, nil
+}
+
+// cached returns the combined cached permissions of the roles, if every role has a fresh
+// cache entry and together they are at least as new as version.
+func cached(roleIds []uint, version uint) (Grants, bool) {
+	now := time.Now()
+	mu.RLock()
+	defer mu.RUnlock()
+	var sum uint
+	entries := make([]Grants, len(roleIds))
+	for i, roleId := range roleIds {
+		cached, ok := roles[roleId]
+		if !ok || now.Sub(cached.loadedAt) >= CacheTTL {
+			return nil, false
+		}
+		sum += cached.version
+		entries[i] = cached.grants
+	}
+	if sum < version {
+		return nil, false
+	}
+	return merge(entries), true
+}
+
+// loadAll loads the permissions of every role and combines them.
+func loadAll(roleIds []uint) (Grants, error) {
+	entries := make([]Grants, len(roleIds))
+	for i, roleId := range roleIds {
+		grants, err := load(roleId)
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = grants
+	}
+	return merge(entries), nil
+}
+
+// merge returns the union of several permission sets without modifying them.
+func merge(entries []Grants) Grants {
+	if len(entries) == 1 {
+		return entries[0]
+	}
+	merged := make(Grants)
+	for _, grants := range entries {
+		for name, conditions := range grants {
+			merged[name] = append(merged[name], conditions...)
+		}
+	}
+	return merged
+}
+
+// InvalidateRole drops the cached permissions of the given roles.
+// It must be called whenever a role's permissions change or the role is deleted, for the role
+// and every role that inherits from it, as returned by BumpVersions.
+func InvalidateRole(roleIds ...uint) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, roleId := range roleIds {
+		delete(roles, roleId)
+	}
+}
+
+// InvalidateUser drops the cached roles of a user. It must be called whenever roles are granted
+// to or revoked from the user, or the user is deleted.
+func InvalidateUser(userId uint) {
+	users.Delete(userId)
+}
+
+// InvalidateAll drops every cached permission set and role assignment, e.g. after switching to another
+// database.
+func InvalidateAll() {
+	mu.Lock()
+	roles = map[uint]entry{}
+	mu.Unlock()
+	users.Clear()
+}
+
+// load reads a role's effective permissions, including those inherited from its ancestors,
+// from the database and caches them.
+func load(roleId uint) (Grants, error) {
+	chain, err := Ancestors(db.Session(), roleId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// A deleted role grants nothing.
+		chain, err = []models.Role{{Id: roleId}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	role := chain[0]
+	grants := make(Grants)
+	for _, permission := range permissionsOf(chain) {
+		// Legacy permissions that could not be mapped to a resource grant nothing.
+		if permission.Resource == "" {
+			continue
+		}
+		grants.Add(permission.Resource, Action(permission.Action), permission.Condition)
+	}
+	mu.Lock()
+	roles[roleId] = entry{
+		grants:   grants,
+		version:  role.PermissionsVersion,
+		loadedAt: time.Now(),
+	}
+	mu.Unlock()
+	return grants, nil
+}
+
+// permissionsOf returns the permissions of every role in chain.
+func permissionsOf(chain []models.Role) []models.Permission {
+	permissions := make([]models.Permission, 0)
+	for _, role := range chain {
+		permissions = append(permissions, role.Permissions...)
+	}
+	return permissions
+}
@@ -0,0 +1,268 @@
+package authz_test
+
+import (
+	"testing"
+
+	"github.com/lemadane/admin_backend_gofiber/authz"
+	"github.com/lemadane/admin_backend_gofiber/db"
+	"github.com/lemadane/admin_backend_gofiber/internal/testdb"
+	"github.com/lemadane/admin_backend_gofiber/models"
+)
+
+// createRole stores a role with the given parent, which may be nil, and permissions.
+func createRole(t *testing.T, name string, parentId *uint, permissions ...string) models.Role {
+	t.Helper()
+	role := models.Role{Name: name, ParentId: parentId}
+	if err := db.Session().Create(&role).Error; err != nil {
+		t.Fatal(err)
+	}
+	setPermissions(t, role, permissions...)
+	return role
+}
+
+// setPermissions replaces the permissions of a role with those of the given canonical names,
+// without changing its permissions version.
+func setPermissions(t *testing.T, role models.Role, names ...string) {
+	t.Helper()
+	permissions := make([]models.Permission, len(names))
+	for i, name := range names {
+		resource, action, condition, ok := authz.ParseName(name)
+		if !ok {
+			t.Fatalf("invalid permission name %q", name)
+		}
+		permissions[i] = models.Permission{Name: name, Resource: resource, Action: string(action), Condition: condition}
+		if err := db.Session().Where(models.Permission{Name: name}).FirstOrCreate(&permissions[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Session().Model(&role).Association("Permissions").Replace(permissions); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// createUser stores a user in the given region holding the given roles.
+func createUser(t *testing.T, region string, roles ...models.Role) models.User {
+	t.Helper()
+	user := models.User{Firstname: "Test", Email: region + "@example.com", Region: region, Roles: roles}
+	if err := db.Session().Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// subjectOf returns the subject described by an access token issued to the user now.
+func subjectOf(t *testing.T, userId uint) authz.Subject {
+	t.Helper()
+	roleIds, version, err := authz.Snapshot(userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return authz.Subject{UserId: userId, RoleIds: roleIds, PermissionsVersion: version}
+}
+
+func TestGrantsConditions(t *testing.T) {
+	tests := []struct {
+		name       string
+		grants     authz.Grants
+		resource   string
+		action     authz.Action
+		conditions []string
+		ok         bool
+	}{
+		{
+			name:     "exact grant",
+			grants:   authz.Grants{"orders:list": {""}},
+			resource: "orders", action: authz.ActionList,
+			ok: true,
+		},
+		{
+			name:     "conditional grant",
+			grants:   authz.Grants{"orders:list": {"same_region"}},
+			resource: "orders", action: authz.ActionList,
+			conditions: []string{"same_region"}, ok: true,
+		},
+		{
+			name:     "wildcard action",
+			grants:   authz.Grants{"orders:*": {""}},
+			resource: "orders", action: authz.ActionExport,
+			ok: true,
+		},
+		{
+			name:     "wildcard resource",
+			grants:   authz.Grants{"*:read": {""}},
+			resource: "users", action: authz.ActionRead,
+			ok: true,
+		},
+		{
+			name:     "wildcard resource and action",
+			grants:   authz.Grants{"*:*": {""}},
+			resource: "roles", action: authz.ActionDelete,
+			ok: true,
+		},
+		{
+			name:     "conditions of every matching grant",
+			grants:   authz.Grants{"users:read": {"self"}, "*:read": {"same_region"}},
+			resource: "users", action: authz.ActionRead,
+			conditions: []string{"self", "same_region"}, ok: true,
+		},
+		{
+			name:     "unconditional grant overrides conditions",
+			grants:   authz.Grants{"users:read": {"self"}, "users:*": {""}},
+			resource: "users", action: authz.ActionRead,
+			ok: true,
+		},
+		{
+			name:     "other action",
+			grants:   authz.Grants{"orders:list": {""}},
+			resource: "orders", action: authz.ActionExport,
+		},
+		{
+			name:     "other resource",
+			grants:   authz.Grants{"orders:*": {""}},
+			resource: "users", action: authz.ActionList,
+		},
+		{
+			name:     "no grants",
+			grants:   authz.Grants{},
+			resource: "users", action: authz.ActionList,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conditions, ok := test.grants.Conditions(test.resource, test.action)
+			if ok != test.ok {
+				t.Fatalf("Conditions() ok = %v, want %v", ok, test.ok)
+			}
+			if len(conditions) != len(test.conditions) {
+				t.Fatalf("Conditions() = %q, want %q", conditions, test.conditions)
+			}
+			for i := range conditions {
+				if conditions[i] != test.conditions[i] {
+					t.Fatalf("Conditions() = %q, want %q", conditions, test.conditions)
+				}
+			}
+		})
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	// Each test starts with a user holding the role child, which inherits from parent, and
+	// with the user's permissions cached. The role other is not held.
+	type fixture struct {
+		user                 models.User
+		parent, child, other models.Role
+		// subject is the subject of a token issued before the change.
+		subject authz.Subject
+	}
+	tests := []struct {
+		name string
+		// change changes the roles and returns the subject to authorize.
+		change  func(t *testing.T, f fixture) authz.Subject
+		allowed []string
+		denied  []string
+	}{
+		{
+			name:    "own and inherited permissions",
+			change:  func(t *testing.T, f fixture) authz.Subject { return f.subject },
+			allowed: []string{"orders:list", "users:read"},
+			denied:  []string{"orders:export", "users:update"},
+		},
+		{
+			name: "permissions of every role",
+			change: func(t *testing.T, f fixture) authz.Subject {
+				if err := db.Session().Create(&models.UserRole{UserId: f.user.Id, RoleId: f.other.Id}).Error; err != nil {
+					t.Fatal(err)
+				}
+				authz.InvalidateUser(f.user.Id)
+				return subjectOf(t, f.user.Id)
+			},
+			allowed: []string{"orders:list", "users:read", "orders:export"},
+		},
+		{
+			name: "cached permissions as new as the token",
+			change: func(t *testing.T, f fixture) authz.Subject {
+				setPermissions(t, f.child, "orders:delete")
+				return f.subject
+			},
+			allowed: []string{"orders:list"},
+			denied:  []string{"orders:delete"},
+		},
+		{
+			name: "permissions newer than the cache",
+			change: func(t *testing.T, f fixture) authz.Subject {
+				setPermissions(t, f.child, "orders:delete")
+				if _, err := authz.BumpVersions(db.Session(), f.child.Id); err != nil {
+					t.Fatal(err)
+				}
+				return subjectOf(t, f.user.Id)
+			},
+			allowed: []string{"orders:delete", "users:read"},
+			denied:  []string{"orders:list"},
+		},
+		{
+			name: "inherited permissions newer than the cache",
+			change: func(t *testing.T, f fixture) authz.Subject {
+				setPermissions(t, f.parent, "users:update")
+				if _, err := authz.BumpVersions(db.Session(), f.parent.Id); err != nil {
+					t.Fatal(err)
+				}
+				return subjectOf(t, f.user.Id)
+			},
+			allowed: []string{"orders:list", "users:update"},
+			denied:  []string{"users:read"},
+		},
+		{
+			name: "invalidated permissions",
+			change: func(t *testing.T, f fixture) authz.Subject {
+				setPermissions(t, f.child, "orders:delete")
+				authz.InvalidateRole(f.child.Id)
+				return f.subject
+			},
+			allowed: []string{"orders:delete"},
+			denied:  []string{"orders:list"},
+		},
+		{
+			name: "current roles rather than those of the token",
+			change: func(t *testing.T, f fixture) authz.Subject {
+				if err := db.Session().Model(&f.user).Association("Roles").Replace([]models.Role{f.other}); err != nil {
+					t.Fatal(err)
+				}
+				authz.InvalidateUser(f.user.Id)
+				return f.subject
+			},
+			allowed: []string{"orders:export"},
+			denied:  []string{"orders:list", "users:read"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testdb.Setup(t)
+			var f fixture
+			f.parent = createRole(t, "parent", nil, "users:read")
+			f.child = createRole(t, "child", &f.parent.Id, "orders:list")
+			f.other = createRole(t, "other", nil, "orders:export")
+			f.user = createUser(t, "emea", f.child)
+			f.subject = subjectOf(t, f.user.Id)
+			if _, err := authz.Permissions(f.subject); err != nil {
+				t.Fatal(err)
+			}
+
+			grants, err := authz.Permissions(test.change(t, f))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range test.allowed {
+				resource, action, _, _ := authz.ParseName(name)
+				if !grants.Allows(resource, action) {
+					t.Errorf("%s is not allowed by %v", name, grants)
+				}
+			}
+			for _, name := range test.denied {
+				resource, action, _, _ := authz.ParseName(name)
+				if grants.Allows(resource, action) {
+					t.Errorf("%s is allowed by %v", name, grants)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package authz
+
+import (
+	"sort"
+
+	"github.com/lemadane/admin_backend_gofiber/db"
+	"github.com/lemadane/admin_backend_gofiber/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Condition restricts a permission to the rows of a resource that satisfy it for the acting user.
+// It returns a SQL expression over the resource's table, e.g. orders.region = 'emea' for
+// a support agent whose region is "emea".
+type Condition func(actor models.User) clause.Expression
+
+// conditions holds the registered conditions, keyed by resource and then by name.
+var conditions = map[string]map[string]Condition{}
+
+// nothing is the expression that no row satisfies.
+var nothing = clause.Expr{SQL: "1 = 0"}
+
+// Built-in conditions.
+func init() {
+	RegisterCondition("users", "self", func(actor models.User) clause.Expression {
+		return gorm.Expr("users.id = ?", actor.Id)
+	})
+	RegisterCondition("users", "same_region", func(actor models.User) clause.Expression {
+		if actor.Region == "" {
+			return nothing
+		}
+		return gorm.Expr("users.region = ?", actor.Region)
+	})
+	RegisterCondition("users", "lower_level", func(actor models.User) clause.Expression {
+		// Users holding any role at or above the actor's level are excluded.
+		return gorm.Expr(`users.id NOT IN (
+			SELECT user_roles.user_id FROM user_roles
+			JOIN roles ON roles.id = user_roles.role_id
+			WHERE roles.level >= ?
+		)`, actor.Level())
+	})
+	RegisterCondition("orders", "same_region", func(actor models.User) clause.Expression {
+		if actor.Region == "" {
+			return nothing
+		}
+		return gorm.Expr("orders.region = ?", actor.Region)
+	})
+}
+
+// RegisterCondition makes a condition available to permissions on resource under name.
+// It is meant to be called from init functions and is not safe for concurrent use.
+func RegisterCondition(resource string, name string, condition Condition) {
+	if conditions[resource] == nil {
+		conditions[resource] = map[string]Condition{}
+	}
+	conditions[resource][name] = condition
+}
+
+// IsCondition reports whether a condition is registered for resource under name.
+func IsCondition(resource string, name string) bool {
+	_, ok := conditions[resource][name]
+	return ok
+}
+
+// ConditionNames returns the names of the conditions registered for resource, sorted.
+func ConditionNames(resource string) []string {
+	names := make([]string, 0, len(conditions[resource]))
+	for name := range conditions[resource] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Decision is the outcome of authorizing an action on a resource.
+type Decision struct {
+	Resource string
+	Action   Action
+	// Conditions lists the conditions under which the action is granted.
+	// It is empty if the action is granted on every row.
+	Conditions []string
+	// actor is the acting user, loaded only when there are conditions to evaluate.
+	actor models.User
+}
+
+// Decide authorizes the subject to perform action on resource.
+// It reports false if no permission grants the action. Otherwise the returned Decision's Scope
+// restricts queries to the rows covered by the granted permissions: a row is visible if any of
+// the conditions holds for it, and every row is visible if one of the grants is unconditional.
+// Conditions only restrict existing rows, so conditional grants never allow creating rows.
+func Decide(subject Subject, resource string, action Action) (Decision, bool, error) {
+	grants, err := Permissions(subject)
+	if err != nil {
+		return Decision{}, false, err
+	}
+	granted, ok := grants.Conditions(resource, action)
+	if !ok || (action == ActionCreate && len(granted) > 0) {
+		return Decision{}, false, nil
+	}
+	decision := Decision{
+		Resource:   resource,
+		Action:     action,
+		Conditions: granted,
+	}
+	if len(granted) > 0 {
+		if err := db.Session().Preload("Roles").First(&decision.actor, subject.UserId).Error; err != nil {
+			return Decision{}, false, err
+		}
+	}
+	return decision, true, nil
+}
+
+// Restricted reports whether the decision only covers some rows of the resource.
+func (decision Decision) Restricted() bool {
+	return len(decision.Conditions) > 0
+}
+
+// Scope returns the scope that restricts a query on the resource's table to the rows
+// covered by the decision. Conditions that are not registered for the resource match nothing.
+func (decision Decision) Scope() models.Scope {
+	if !decision.Restricted() {
+		return models.Unrestricted
+	}
+	exprs := make([]clause.Expression, len(decision.Conditions))
+	for i, name := range decision.Conditions {
+		condition, ok := conditions[decision.Resource][name]
+		if !ok {
+			exprs[i] = nothing
+			continue
+		}
+		exprs[i] = condition(decision.actor)
+	}
+	restriction := models.AnyOf(exprs)
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(restriction)
+	}
+}
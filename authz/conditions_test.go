@@ -0,0 +1,174 @@
+package authz_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lemadane/admin_backend_gofiber/authz"
+	"github.com/lemadane/admin_backend_gofiber/db"
+	"github.com/lemadane/admin_backend_gofiber/internal/testdb"
+	"github.com/lemadane/admin_backend_gofiber/models"
+)
+
+func TestDecide(t *testing.T) {
+	// Each test authorizes an actor in the region emea, holding a role of level 5 with the given
+	// permissions, among these users and orders, which are told apart by their emails.
+	users := []struct {
+		email  string
+		region string
+		// level is the level of the user's role; zero means that the user holds no role.
+		level uint
+	}{
+		{"emea-lower@example.com", "emea", 3},
+		{"apac-higher@example.com", "apac", 7},
+		{"apac-none@example.com", "apac", 0},
+	}
+	orders := []models.Order{
+		{Email: "emea-order@example.com", Region: "emea"},
+		{Email: "apac-order@example.com", Region: "apac"},
+	}
+	const actor = "actor@example.com"
+
+	tests := []struct {
+		name        string
+		permissions []string
+		// noRegion leaves the actor without a region.
+		noRegion bool
+		resource string
+		action   authz.Action
+		ok       bool
+		// visible are the emails of the rows in the scope of the decision.
+		visible []string
+	}{
+		{
+			name:        "unconditional grant",
+			permissions: []string{"orders:list"},
+			resource:    "orders", action: authz.ActionList,
+			ok: true, visible: []string{"apac-order@example.com", "emea-order@example.com"},
+		},
+		{
+			name:        "wildcard grant",
+			permissions: []string{"*:*"},
+			resource:    "users", action: authz.ActionDelete,
+			ok: true, visible: []string{actor, "apac-higher@example.com", "apac-none@example.com", "emea-lower@example.com"},
+		},
+		{
+			name:        "orders of the same region",
+			permissions: []string{"orders:list:same_region"},
+			resource:    "orders", action: authz.ActionList,
+			ok: true, visible: []string{"emea-order@example.com"},
+		},
+		{
+			name:        "same region without a region",
+			permissions: []string{"orders:list:same_region"},
+			noRegion:    true,
+			resource:    "orders", action: authz.ActionList,
+			ok: true, visible: []string{},
+		},
+		{
+			name:        "self",
+			permissions: []string{"users:read:self"},
+			resource:    "users", action: authz.ActionRead,
+			ok: true, visible: []string{actor},
+		},
+		{
+			name:        "users of a lower level",
+			permissions: []string{"users:update:lower_level"},
+			resource:    "users", action: authz.ActionUpdate,
+			ok: true, visible: []string{"apac-none@example.com", "emea-lower@example.com"},
+		},
+		{
+			name:        "any of several conditions",
+			permissions: []string{"users:read:self", "users:*:same_region"},
+			resource:    "users", action: authz.ActionRead,
+			ok: true, visible: []string{actor, "emea-lower@example.com"},
+		},
+		{
+			name:        "unconditional grant among conditional ones",
+			permissions: []string{"users:read:self", "*:read"},
+			resource:    "users", action: authz.ActionRead,
+			ok: true, visible: []string{actor, "apac-higher@example.com", "apac-none@example.com", "emea-lower@example.com"},
+		},
+		{
+			name:        "unregistered condition",
+			permissions: []string{"orders:list:self"},
+			resource:    "orders", action: authz.ActionList,
+			ok: true, visible: []string{},
+		},
+		{
+			name:        "conditional create",
+			permissions: []string{"orders:create:same_region"},
+			resource:    "orders", action: authz.ActionCreate,
+		},
+		{
+			name:        "unconditional create",
+			permissions: []string{"orders:create"},
+			resource:    "orders", action: authz.ActionCreate,
+			ok: true, visible: []string{"apac-order@example.com", "emea-order@example.com"},
+		},
+		{
+			name:        "other action",
+			permissions: []string{"orders:list"},
+			resource:    "orders", action: authz.ActionExport,
+		},
+		{
+			name:     "no permissions",
+			resource: "users", action: authz.ActionList,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testdb.Setup(t)
+			for i, user := range users {
+				var roles []models.Role
+				if user.level > 0 {
+					role := createRole(t, user.email, nil)
+					role.Level = user.level
+					if err := db.Session().Save(&role).Error; err != nil {
+						t.Fatal(err)
+					}
+					roles = append(roles, role)
+				}
+				record := models.User{Firstname: "Test", Email: user.email, Region: user.region, Roles: roles}
+				if err := db.Session().Create(&record).Error; err != nil {
+					t.Fatalf("user %d: %v", i, err)
+				}
+			}
+			if err := db.Session().Create(orders).Error; err != nil {
+				t.Fatal(err)
+			}
+			role := createRole(t, "actor", nil, test.permissions...)
+			role.Level = 5
+			if err := db.Session().Save(&role).Error; err != nil {
+				t.Fatal(err)
+			}
+			region := "emea"
+			if test.noRegion {
+				region = ""
+			}
+			user := models.User{Firstname: "Actor", Email: actor, Region: region, Roles: []models.Role{role}}
+			if err := db.Session().Create(&user).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			decision, ok, err := authz.Decide(subjectOf(t, user.Id), test.resource, test.action)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != test.ok {
+				t.Fatalf("Decide() ok = %v, want %v", ok, test.ok)
+			}
+			if !ok {
+				return
+			}
+			visible := make([]string, 0)
+			err = db.Session().Table(test.resource).Scopes(decision.Scope()).Order("email").Pluck("email", &visible).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(visible, test.visible) {
+				t.Errorf("visible = %q, want %q", visible, test.visible)
+			}
+		})
+	}
+}
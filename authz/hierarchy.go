@@ -0,0 +1,124 @@
+package authz
+
+import (
+	"errors"
+
+	"github.com/lemadane/admin_backend_gofiber/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrRoleCycle is returned when a role would become its own ancestor.
+var ErrRoleCycle = errors.New("role hierarchy would contain a cycle")
+
+// EffectivePermission is a permission held by a role, either directly or through an ancestor.
+type EffectivePermission struct {
+	models.Permission
+	// GrantedBy is the ID of the role the permission is assigned to.
+	GrantedBy uint `json:"granted_by"`
+}
+
+// Ancestors returns the role with the given ID followed by its parent, its parent's parent and
+// so on, each with its own permissions. A cycle left in the data ends the chain instead of
+// looping forever.
+func Ancestors(tx *gorm.DB, roleId uint) ([]models.Role, error) {
+	chain := make([]models.Role, 0)
+	seen := map[uint]bool{}
+	for id := &roleId; id != nil && !seen[*id]; {
+		var role models.Role
+		if err := tx.Preload("Permissions").First(&role, *id).Error; err != nil {
+			if len(chain) > 0 && errors.Is(err, gorm.ErrRecordNotFound) {
+				// A parent that no longer exists ends the chain.
+				break
+			}
+			return nil, err
+		}
+		seen[role.Id] = true
+		chain = append(chain, role)
+		id = role.ParentId
+	}
+	return chain, nil
+}
+
+// EffectivePermissions returns every permission the role holds, its own first and then those
+// it inherits from its ancestors, nearest first. A permission held at several levels is
+// reported once, for the nearest role that holds it.
+func EffectivePermissions(tx *gorm.DB, roleId uint) ([]EffectivePermission, error) {
+	chain, err := Ancestors(tx, roleId)
+	if err != nil {
+		return nil, err
+	}
+	effective := make([]EffectivePermission, 0)
+	seen := map[uint]bool{}
+	for _, role := range chain {
+		for _, permission := range role.Permissions {
+			if seen[permission.Id] {
+				continue
+			}
+			seen[permission.Id] = true
+			effective = append(effective, EffectivePermission{
+				Permission: permission,
+				GrantedBy:  role.Id,
+			})
+		}
+	}
+	return effective, nil
+}
+
+// CheckParent returns ErrRoleCycle if making parentId the parent of roleId would make the
+// role its own ancestor.
+func CheckParent(tx *gorm.DB, roleId uint, parentId uint) error {
+	if parentId == roleId {
+		return ErrRoleCycle
+	}
+	chain, err := Ancestors(tx, parentId)
+	if err != nil {
+		return err
+	}
+	for _, ancestor := range chain {
+		if ancestor.Id == roleId {
+			return ErrRoleCycle
+		}
+	}
+	return nil
+}
+
+// Descendants returns the IDs of the roles that inherit from the role, directly or indirectly.
+func Descendants(tx *gorm.DB, roleId uint) ([]uint, error) {
+	descendants := make([]uint, 0)
+	seen := map[uint]bool{roleId: true}
+	frontier := []uint{roleId}
+	for len(frontier) > 0 {
+		var children []uint
+		if err := tx.Model(&models.Role{}).Where("parent_id IN ?", frontier).Pluck("id", &children).Error; err != nil {
+			return nil, err
+		}
+		frontier = frontier[:0]
+		for _, child := range children {
+			if !seen[child] {
+				seen[child] = true
+				descendants = append(descendants, child)
+				frontier = append(frontier, child)
+			}
+		}
+	}
+	return descendants, nil
+}
+
+// BumpVersions increments the permissions version of the role and of every role that inherits
+// from it, so that tokens issued before a change to its permissions or its place in the
+// hierarchy are no longer trusted. It returns the IDs of the affected roles, whose cached
+// permissions must be dropped with InvalidateRole once the change is committed.
+func BumpVersions(tx *gorm.DB, roleId uint) ([]uint, error) {
+	descendants, err := Descendants(tx, roleId)
+	if err != nil {
+		return nil, err
+	}
+	affected := append([]uint{roleId}, descendants...)
+	err = tx.Model(&models.Role{}).Where("id IN ?", affected).
+		UpdateColumn("permissions_version", gorm.Expr("permissions_version + 1")).Error
+	if err != nil {
+		return nil, err
+	}
+	return affected, nil
+}
@@ -0,0 +1,177 @@
+package authz
+
+import "strings"
+
+// Action is an operation on a resource that a permission grants.
+type Action string
+
+// Actions that permissions can grant.
+const (
+	ActionList    Action = "list"
+	ActionRead    Action = "read"
+	ActionCreate  Action = "create"
+	ActionUpdate  Action = "update"
+	ActionDelete  Action = "delete"
+	ActionExport  Action = "export"
+	ActionApprove Action = "approve"
+)
+
+// Wildcard matches any resource or any action in a permission, as in "orders:*".
+const Wildcard = "*"
+
+// Actions lists every concrete action in the order they are presented to users.
+var Actions = []Action{
+	ActionList,
+	ActionRead,
+	ActionCreate,
+	ActionUpdate,
+	ActionDelete,
+	ActionExport,
+	ActionApprove,
+}
+
+// Resources lists the resources that permissions are defined for.
+var Resources = []string{"users", "roles", "permissions", "orders", "images", "products", "audit_logs"}
+
+// ResourceActions lists, for every resource, the actions that the routes check, in the order of Actions.
+// The seed only creates permissions for these actions, and route policies may not require any other,
+// so that no permission is offered that grants nothing.
+var ResourceActions = map[string][]Action{
+	"users":       {ActionList, ActionRead, ActionCreate, ActionUpdate, ActionDelete},
+	"roles":       {ActionList, ActionRead, ActionCreate, ActionUpdate, ActionDelete},
+	"permissions": {ActionList, ActionRead, ActionCreate, ActionUpdate, ActionDelete},
+	"orders":      {ActionList, ActionExport},
+	"images":      {ActionCreate},
+	"products":    {ActionList, ActionRead, ActionCreate, ActionUpdate, ActionDelete},
+	"audit_logs":  {ActionList},
+}
+
+// Categories groups the resources for presentation, e.g. in the role editor.
+var Categories = map[string]string{
+	"users":       "Access control",
+	"roles":       "Access control",
+	"permissions": "Access control",
+	"orders":      "Sales",
+	"images":      "Catalog",
+	"products":    "Catalog",
+	"audit_logs":  "Administration",
+}
+
+// verbs are the words that describe each action in permission descriptions.
+var verbs = map[Action]string{
+	ActionList:    "List",
+	ActionRead:    "View",
+	ActionCreate:  "Create",
+	ActionUpdate:  "Update",
+	ActionDelete:  "Delete",
+	ActionExport:  "Export",
+	ActionApprove: "Approve",
+	Wildcard:      "Manage",
+}
+
+// IsResource reports whether resource is a known resource or the wildcard.
+func IsResource(resource string) bool {
+	if resource == Wildcard {
+		return true
+	}
+	for _, known := range Resources {
+		if known == resource {
+			return true
+		}
+	}
+	return false
+}
+
+// Describe returns a default description of the permission that grants action on resource
+// under condition, e.g. "List orders (same_region)" or "List audit logs".
+func Describe(resource string, action Action, condition string) string {
+	if resource == Wildcard {
+		resource = "all resources"
+	}
+	resource = strings.ReplaceAll(resource, "_", " ")
+	description := verbs[action] + " " + resource
+	if condition != "" {
+		description += " (" + condition + ")"
+	}
+	return description
+}
+
+// IsAction reports whether action is a concrete action or the wildcard.
+func IsAction(action string) bool {
+	if action == Wildcard {
+		return true
+	}
+	for _, known := range Actions {
+		if string(known) == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Name returns the canonical name of the permission that grants action on resource,
+// e.g. "orders:export". A permission restricted by a row-level condition carries the
+// condition's name as a third part, e.g. "orders:list:same_region".
+func Name(resource string, action Action, condition ...string) string {
+	name := resource + ":" + string(action)
+	if len(condition) > 0 && condition[0] != "" {
+		name += ":" + condition[0]
+	}
+	return name
+}
+
+// ParseName splits a canonical permission name into its resource, action and condition.
+func ParseName(name string) (string, Action, string, bool) {
+	parts := strings.SplitN(name, ":", 3)
+	if len(parts) < 2 || parts[0] == "" || !IsAction(parts[1]) {
+		return "", "", "", false
+	}
+	condition := ""
+	if len(parts) == 3 {
+		if parts[2] == "" {
+			return "", "", "", false
+		}
+		condition = parts[2]
+	}
+	return parts[0], Action(parts[1]), condition, true
+}
+
+// Grants maps the "resource:action" names of the permissions held by a role to the
+// conditions they are granted under. An empty condition grants the action on every row.
+type Grants map[string][]string
+
+// Add records that action on resource is granted under condition.
+func (grants Grants) Add(resource string, action Action, condition string) {
+	name := Name(resource, action)
+	grants[name] = append(grants[name], condition)
+}
+
+// Allows reports whether the grants allow action on resource, on at least some rows.
+func (grants Grants) Allows(resource string, action Action) bool {
+	_, ok := grants.Conditions(resource, action)
+	return ok
+}
+
+// Conditions returns the conditions under which action on resource is granted.
+// A grant matches if it names the resource and the action exactly, or uses the wildcard
+// for either of them. It reports false if no grant matches, and returns no conditions
+// if a matching grant is unconditional.
+func (grants Grants) Conditions(resource string, action Action) ([]string, bool) {
+	var conditions []string
+	found := false
+	for _, name := range []string{
+		Name(resource, action),
+		Name(resource, Wildcard),
+		Name(Wildcard, action),
+		Name(Wildcard, Wildcard),
+	} {
+		for _, condition := range grants[name] {
+			if condition == "" {
+				return nil, true
+			}
+			conditions = append(conditions, condition)
+			found = true
+		}
+	}
+	return conditions, found
+}
@@ -0,0 +1,279 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Environment profiles.
+const (
+	Development = "dev"
+	Test        = "test"
+	Production  = "prod"
+)
+
+// DefaultSecret is the JWT signing secret used when none is configured.
+// It is only accepted outside of the production profile.
+const DefaultSecret = "secret"
+
+// Config holds the complete application configuration.
+type Config struct {
+	// Env is the environment profile. It is only taken from ADMIN_ENV, never from a file.
+	Env      string   `yaml:"-" toml:"-"`
+	Server   Server   `yaml:"server" toml:"server"`
+	Database Database `yaml:"database" toml:"database"`
+	Auth     Auth     `yaml:"auth" toml:"auth"`
+	Uploads  Uploads  `yaml:"uploads" toml:"uploads"`
+	Search   Search   `yaml:"search" toml:"search"`
+}
+
+// Server configures the HTTP listener.
+type Server struct {
+	// Addr is the address the server listens on, e.g. ":5000".
+	Addr string `yaml:"addr" toml:"addr"`
+	// PublicURL is the externally reachable base URL, used to build links to uploaded files.
+	PublicURL string `yaml:"public_url" toml:"public_url"`
+}
+
+// Database configures the database connection.
+type Database struct {
+	// Driver is one of "mysql", "postgres" or "sqlite".
+	Driver string `yaml:"driver" toml:"driver"`
+	DSN    string `yaml:"dsn" toml:"dsn"`
+	// AutoMigrate applies pending migrations when the server starts.
+	AutoMigrate bool `yaml:"auto_migrate" toml:"auto_migrate"`
+}
+
+// Auth configures token signing, session cookies and registration.
+type Auth struct {
+	Secret          string        `yaml:"secret" toml:"secret"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" toml:"access_token_ttl"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" toml:"refresh_token_ttl"`
+	CookieSecure    bool          `yaml:"cookie_secure" toml:"cookie_secure"`
+	// RegistrationRole is the name of the role granted to self-registered users.
+	// When empty, or when no role has that name, they are granted no role.
+	RegistrationRole string `yaml:"registration_role" toml:"registration_role"`
+}
+
+// Uploads configures where uploaded images are stored.
+type Uploads struct {
+	Dir string `yaml:"dir" toml:"dir"`
+}
+
+// Search configures the search endpoint.
+type Search struct {
+	// Backend is "database", which queries the full-text indexes of MySQL and PostgreSQL for the search
+	// terms at the start of a word of the searchable fields, and on SQLite finds them anywhere with LIKE
+	// queries, or "memory", which keeps an inverted index of the words of the searchable fields in
+	// memory and finds the terms at the start of a word, only querying the database for the matches.
+	Backend string `yaml:"backend" toml:"backend"`
+}
+
+// current is the configuration loaded at startup.
+var current = Defaults(Development)
+
+// Get returns the configuration loaded at startup.
+// Before Load is called it returns the development defaults.
+func Get() *Config {
+	return current
+}
+
+// Set replaces the global configuration. It is intended for tests and tools.
+func Set(cfg *Config) {
+	current = cfg
+}
+
+// Defaults returns the default configuration for the given environment profile.
+func Defaults(env string) *Config {
+	cfg := &Config{
+		Env: env,
+		Server: Server{
+			Addr:      ":5000",
+			PublicURL: "http://localhost:5000",
+		},
+		Database: Database{
+			Driver:      "mysql",
+			DSN:         "root:mel@tcp(localhost:3306)/mysql?charset=utf8&parseTime=True&loc=Local",
+			AutoMigrate: true,
+		},
+		Auth: Auth{
+			Secret:          DefaultSecret,
+			AccessTokenTTL:  time.Minute * 15,
+			RefreshTokenTTL: time.Hour * 24 * 30,
+			CookieSecure:    false,
+			// Created by the seed command, without any permissions.
+			RegistrationRole: "User",
+		},
+		Uploads: Uploads{
+			Dir: "./uploads",
+		},
+		Search: Search{
+			Backend: "database",
+		},
+	}
+	switch env {
+	case Test:
+		// Tests run against a private in-memory database that needs no server.
+		cfg.Database = Database{
+			Driver:      "sqlite",
+			DSN:         "file::memory:?cache=shared",
+			AutoMigrate: true,
+		}
+	case Production:
+		// Production schema changes are applied explicitly with the migrate command.
+		cfg.Database.AutoMigrate = false
+		cfg.Auth.CookieSecure = true
+	}
+	return cfg
+}
+
+// Load builds the configuration, validates it and makes it the global configuration.
+// The environment profile is taken from ADMIN_ENV (default "dev") and selects the defaults.
+// Values from the file named by ADMIN_CONFIG (YAML or TOML, chosen by extension) are
+// applied on top of the defaults, and ADMIN_* environment variables override both.
+func Load() (*Config, error) {
+	env := os.Getenv("ADMIN_ENV")
+	if env == "" {
+		env = Development
+	}
+	cfg := Defaults(env)
+	if path := os.Getenv("ADMIN_CONFIG"); path != "" {
+		if err := loadFile(cfg, path); err != nil {
+			return nil, err
+		}
+	}
+	if err := loadEnv(cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	current = cfg
+	return cfg, nil
+}
+
+// Validate checks that the configuration is complete and safe for its environment.
+func (cfg *Config) Validate() error {
+	var errs []error
+	switch cfg.Env {
+	case Development, Test, Production:
+	default:
+		errs = append(errs, fmt.Errorf("env must be one of %q, %q or %q, got %q", Development, Test, Production, cfg.Env))
+	}
+	if cfg.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr is required"))
+	}
+	switch cfg.Database.Driver {
+	case "mysql", "postgres", "sqlite":
+	default:
+		errs = append(errs, fmt.Errorf("database.driver must be one of \"mysql\", \"postgres\" or \"sqlite\", got %q", cfg.Database.Driver))
+	}
+	if cfg.Database.DSN == "" {
+		errs = append(errs, errors.New("database.dsn is required"))
+	}
+	if cfg.Auth.Secret == "" {
+		errs = append(errs, errors.New("auth.secret is required"))
+	}
+	if cfg.Auth.AccessTokenTTL <= 0 {
+		errs = append(errs, errors.New("auth.access_token_ttl must be positive"))
+	}
+	if cfg.Auth.RefreshTokenTTL <= cfg.Auth.AccessTokenTTL {
+		errs = append(errs, errors.New("auth.refresh_token_ttl must be longer than auth.access_token_ttl"))
+	}
+	if cfg.Uploads.Dir == "" {
+		errs = append(errs, errors.New("uploads.dir is required"))
+	}
+	switch cfg.Search.Backend {
+	case "database", "memory":
+	default:
+		errs = append(errs, fmt.Errorf("search.backend must be \"database\" or \"memory\", got %q", cfg.Search.Backend))
+	}
+	if cfg.Env == Production {
+		if cfg.Auth.Secret == DefaultSecret {
+			errs = append(errs, errors.New("refusing to start in prod with the default auth.secret"))
+		} else if len(cfg.Auth.Secret) < 32 {
+			errs = append(errs, errors.New("auth.secret must be at least 32 characters in prod"))
+		}
+		if !cfg.Auth.CookieSecure {
+			errs = append(errs, errors.New("auth.cookie_secure must be enabled in prod"))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// loadFile decodes a YAML or TOML configuration file into cfg.
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("unsupported config file %q: expected .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("parsing config file %q: %w", path, err)
+	}
+	return nil
+}
+
+// loadEnv overrides cfg with the ADMIN_* environment variables that are set.
+func loadEnv(cfg *Config) error {
+	stringVars := map[string]*string{
+		"ADMIN_ADDR":              &cfg.Server.Addr,
+		"ADMIN_PUBLIC_URL":        &cfg.Server.PublicURL,
+		"ADMIN_DATABASE_DRIVER":   &cfg.Database.Driver,
+		"ADMIN_DATABASE_DSN":      &cfg.Database.DSN,
+		"ADMIN_JWT_SECRET":        &cfg.Auth.Secret,
+		"ADMIN_UPLOAD_DIR":        &cfg.Uploads.Dir,
+		"ADMIN_REGISTRATION_ROLE": &cfg.Auth.RegistrationRole,
+		"ADMIN_SEARCH_BACKEND":    &cfg.Search.Backend,
+	}
+	for name, field := range stringVars {
+		if value, ok := os.LookupEnv(name); ok {
+			*field = value
+		}
+	}
+	durationVars := map[string]*time.Duration{
+		"ADMIN_ACCESS_TOKEN_TTL":  &cfg.Auth.AccessTokenTTL,
+		"ADMIN_REFRESH_TOKEN_TTL": &cfg.Auth.RefreshTokenTTL,
+	}
+	for name, field := range durationVars {
+		if value, ok := os.LookupEnv(name); ok {
+			duration, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			*field = duration
+		}
+	}
+	boolVars := map[string]*bool{
+		"ADMIN_DATABASE_AUTO_MIGRATE": &cfg.Database.AutoMigrate,
+		"ADMIN_COOKIE_SECURE":         &cfg.Auth.CookieSecure,
+	}
+	for name, field := range boolVars {
+		if value, ok := os.LookupEnv(name); ok {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			*field = parsed
+		}
+	}
+	return nil
+}
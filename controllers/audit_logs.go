@@ -0,0 +1,23 @@
+package controllers
+
+import (
+	"github.com/lemadane/admin_backend_gofiber/db"
+	"github.com/lemadane/admin_backend_gofiber/models"
+	"github.com/lemadane/admin_backend_gofiber/repositories"
+	"github.com/lemadane/admin_backend_gofiber/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AllAuditLogs returns a paginated list of audit log entries, the most recent first unless sorted otherwise;
+// see utils.Paginate for the pagination and sorting parameters.
+// The entries can be filtered by actor, action, target and time like any list, as described by utils.Filter,
+// e.g. /audit-logs?filter[target_type]=roles&filter[target_id]=3&filter[created_at][gte]=2024-01-01.
+// It returns a 422 if a filter is invalid.
+func AllAuditLogs(context *fiber.Ctx) error {
+	page, err := utils.Paginate(context, db.Session(), repositories.AuditLogs, models.Unrestricted)
+	if err != nil {
+		return err
+	}
+	return context.JSON(page)
+}
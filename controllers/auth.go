@@ -1,14 +1,22 @@
 package controllers
 
 import (
-	"strconv"
+	"errors"
 	"time"
 
+	"github.com/lemadane/admin_backend_gofiber/apierror"
+	"github.com/lemadane/admin_backend_gofiber/audit"
+	"github.com/lemadane/admin_backend_gofiber/config"
 	"github.com/lemadane/admin_backend_gofiber/db"
+	"github.com/lemadane/admin_backend_gofiber/dto"
+	"github.com/lemadane/admin_backend_gofiber/middlewares"
 	"github.com/lemadane/admin_backend_gofiber/models"
+	"github.com/lemadane/admin_backend_gofiber/repositories"
 	"github.com/lemadane/admin_backend_gofiber/utils"
+	"github.com/lemadane/admin_backend_gofiber/validation"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 // Ping is a handler function that sends a "pong" response.
@@ -18,124 +26,235 @@ func Ping(context *fiber.Ctx) error {
 
 // Register is a function that handles the registration of a new user.
 // It receives a context object from the Fiber framework and returns an error.
-// The function parses the request body and validates the password.
-// If the passwords match, it creates a new user in the database and returns the user object as JSON.
-// If the passwords do not match, it returns a JSON response with an error message.
+// The function parses the request body into a RegisterRequest and validates it.
+// If the request is valid, it creates a new user in the database, granted the configured registration role
+// if it exists, and returns the user object as JSON.
+// Otherwise, it returns a validation error with a message for each invalid field.
 func Register(context *fiber.Ctx) error {
-	data := make(map[string]string)
-
-	if err := context.BodyParser(&data); err != nil {
+	var request dto.RegisterRequest
+	if err := validation.Parse(context, &request); err != nil {
 		return err
 	}
-
-	if data["password"] != data["password_confirm"] {
-		context.Status(400)
-		return context.JSON(fiber.Map{
-			"message": "passwords do not match",
-		})
-	}
 	user := models.User{
-		Firstname: data["firstname"],
-		Lastname:  data["lastname"],
-		Email:     data["email"],
-		PhoneNo:   data["phone_no"],
-		Password:  data["password"],
-		RoleId:    1,
-	}
-	user.SetPassword(data["password"])
-	db.Session().Create(&user)
-	return context.JSON(user)
+		Firstname: request.Firstname,
+		Lastname:  request.Lastname,
+		Email:     request.Email,
+		PhoneNo:   request.PhoneNo,
+	}
+	if name := config.Get().Auth.RegistrationRole; name != "" {
+		var role models.Role
+		err := db.Session().Where("name = ?", name).First(&role).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if role.Id != 0 {
+			user.Roles = []models.Role{role}
+		}
+	}
+	if err := user.SetPassword(request.Password); err != nil {
+		return err
+	}
+	if err := repositories.Users.Create(db.Session(), &user); err != nil {
+		return err
+	}
+	user, err := repositories.Users.Get(db.Session(), models.Unrestricted, user.Id)
+	if err != nil {
+		return err
+	}
+	return context.JSON(dto.NewUserSelf(user))
 }
 
 // Login handles the login functionality.
 // It receives a request context and attempts to authenticate the user.
-// If the user is found and the password is correct, it returns the user details as JSON.
-// If the user is not found or the password is incorrect, it returns an appropriate error message.
+// If the user is found and the password is correct, it starts a new session, sets the
+// short-lived access token and the refresh token as HttpOnly cookies and returns the user
+// details as JSON. When the `token` query parameter is true both tokens are also returned
+// in the body, for clients that authenticate with a bearer header.
+// If the user is not found or the password is incorrect, it returns a 401 error that does not
+// reveal which of the two was wrong.
 func Login(context *fiber.Ctx) error {
-	data := make(map[string]string)
-	if err := context.BodyParser(&data); err != nil {
+	var request dto.LoginRequest
+	if err := validation.Parse(context, &request); err != nil {
 		return err
 	}
 	var user models.User
-	db.Session().Where("email = ?", data["email"]).First(&user)
+	err := db.Session().Preload("Roles").Where("email = ?", request.Email).First(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
 
-	if user.Id == 0 {
-		context.Status(400)
-		return context.JSON(fiber.Map{
-			"message": "user not found",
-		})
+	if user.Id == 0 || !user.IsCorrectPassword(request.Password) {
+		return apierror.Unauthorized("invalid email or password")
+	}
+
+	tokens, err := utils.IssueSession(user.Id, context.Get(fiber.HeaderUserAgent), context.IP())
+	if err != nil {
+		return err
 	}
+	setSessionCookies(context, tokens)
 
-	if !user.IsCorrectPassword(data["password"]) {
-		context.Status(400)
+	if context.QueryBool("token") {
 		return context.JSON(fiber.Map{
-			"message": "incorrect password",
+			"user":          dto.NewUserSelf(user),
+			"token":         tokens.AccessToken,
+			"refresh_token": tokens.RefreshToken,
+			"token_type":    "Bearer",
+			"expires_in":    int(config.Get().Auth.AccessTokenTTL.Seconds()),
 		})
 	}
+	return context.JSON(dto.NewUserSelf(user))
+}
 
-	return context.JSON(user)
+// Refresh exchanges a refresh token for a new access and refresh token pair.
+// The refresh token is read from the "refresh_token" cookie or, for bearer clients,
+// from the "refresh_token" field of the JSON body. The presented token is rotated and
+// cannot be used again; presenting it a second time revokes the whole session.
+func Refresh(context *fiber.Ctx) error {
+	refreshToken := refreshTokenFromRequest(context)
+	tokens, err := utils.RotateSession(refreshToken, context.Get(fiber.HeaderUserAgent), context.IP())
+	if errors.Is(err, utils.ErrInvalidRefreshToken) || errors.Is(err, utils.ErrRefreshTokenReused) {
+		clearSessionCookies(context)
+		return apierror.Unauthorized(err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	setSessionCookies(context, tokens)
+	return context.JSON(fiber.Map{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(config.Get().Auth.AccessTokenTTL.Seconds()),
+	})
 }
 
-// Logout is a handler function that logs out the user by clearing the JWT cookie.
-// It sets the "jwt" cookie value to an empty string and expires it.
-// Returns a JSON response with a success message.
+// Logout is a handler function that logs out the user.
+// It revokes the session server-side, using the session of the access token or,
+// failing that, the refresh token, and then clears both session cookies.
 func Logout(context *fiber.Ctx) error {
-	cookie := fiber.Cookie{
-		Name:     "jwt",
-		Value:    "",
-		Expires:  time.Now().Add(-time.Duration(time.Now().Local().Day())),
-		HTTPOnly: true,
+	if claims, err := utils.ParseClaims(utils.TokenFromRequest(context)); err == nil && claims.SessionId != "" {
+		if err := utils.RevokeSessionFamily(claims.SessionId); err != nil {
+			return err
+		}
 	}
-	context.Cookie(&cookie)
+	if refreshToken := refreshTokenFromRequest(context); refreshToken != "" {
+		if err := utils.RevokeRefreshToken(refreshToken); err != nil {
+			return err
+		}
+	}
+	clearSessionCookies(context)
 	return context.Status(fiber.StatusNoContent).Send(nil)
 }
 
+// refreshTokenFromRequest reads the refresh token from its cookie or the request body.
+func refreshTokenFromRequest(context *fiber.Ctx) string {
+	if cookie := context.Cookies(utils.RefreshCookieName); cookie != "" {
+		return cookie
+	}
+	data := make(map[string]string)
+	if err := context.BodyParser(&data); err != nil {
+		return ""
+	}
+	return data["refresh_token"]
+}
+
+// setSessionCookies stores the access and refresh tokens in their cookies.
+func setSessionCookies(context *fiber.Ctx, tokens *utils.Tokens) {
+	context.Cookie(sessionCookie(utils.CookieName, tokens.AccessToken, tokens.AccessExpiresAt))
+	context.Cookie(sessionCookie(utils.RefreshCookieName, tokens.RefreshToken, tokens.RefreshExpiresAt))
+}
+
+// clearSessionCookies overwrites both session cookies with empty, already expired values.
+func clearSessionCookies(context *fiber.Ctx) {
+	expired := time.Now().Add(-time.Hour)
+	context.Cookie(sessionCookie(utils.CookieName, "", expired))
+	context.Cookie(sessionCookie(utils.RefreshCookieName, "", expired))
+}
+
+// sessionCookie builds a cookie that carries a session token.
+// The cookie is HttpOnly so scripts cannot read it, SameSite=Strict so it is not attached
+// to cross-site requests, and Secure (HTTPS only) unless disabled in the configuration.
+func sessionCookie(name string, value string, expires time.Time) *fiber.Cookie {
+	return &fiber.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		HTTPOnly: true,
+		Secure:   config.Get().Auth.CookieSecure,
+		SameSite: fiber.CookieSameSiteStrictMode,
+	}
+}
+
 // UpdateInfo updates the user information based on the provided data.
-// It parses the request body, retrieves the user ID from the JWT cookie,
-// and updates the corresponding user record in the database.
+// It parses and validates the request body, retrieves the user ID from the session token,
+// and updates the corresponding user record in the database. Omitted fields are left unchanged.
+// An email taken by another user is reported as a validation error of the email field.
+// The fields that changed are recorded in the audit log.
 // Finally, it returns the updated user information as a JSON response.
 func UpdateInfo(c *fiber.Ctx) error {
-	var data map[string]string
-	if err := c.BodyParser(&data); err != nil {
+	var request dto.UpdateInfoRequest
+	if err := validation.Parse(c, &request); err != nil {
+		return err
+	}
+	userId := middlewares.UserId(c)
+	existing, err := repositories.Users.Get(db.Session(), models.Unrestricted, userId)
+	if err != nil {
 		return err
 	}
-	cookie := c.Cookies("jwt")
-	id, _ := utils.ParseJwt(cookie)
-	userId, _ := strconv.Atoi(*id)
 	user := models.User{
-		Id:        uint(userId),
-		Firstname: data["first_name"],
-		Lastname:  data["last_name"],
-		PhoneNo:   data["phone_no"],
-		Email:     data["email"],
-	}
-	db.Session().Model(&user).Updates(user)
-	return c.JSON(user)
+		Id:        userId,
+		Firstname: request.Firstname,
+		Lastname:  request.Lastname,
+		PhoneNo:   request.PhoneNo,
+		Email:     request.Email,
+	}
+	if err := repositories.Users.Update(db.Session(), &user); err != nil {
+		return validation.Taken(err, "email")
+	}
+	user, err = repositories.Users.Get(db.Session(), models.Unrestricted, user.Id)
+	if err != nil {
+		return err
+	}
+	view := dto.NewUserSelf(user)
+	audit.Target(c, "users", user.Id)
+	audit.Before(c, dto.NewUserSelf(existing))
+	audit.After(c, view)
+	return c.JSON(view)
 }
 
 // UpdatePassword updates the password of a user.
 // It expects a JSON object containing the new password and password confirmation in the request body.
-// If the passwords do not match, it returns a JSON response with a status code of 422 and an error message.
-// It retrieves the user ID from the JWT cookie and updates the password for the corresponding user in the database.
+// If the password is too weak or the passwords do not match, it returns a validation error.
+// It retrieves the user ID from the session token and updates the password for the corresponding user in the database.
+// Every other session of the user is revoked, so that whoever knew the old password is signed out;
+// the session that changed the password stays signed in.
 // Finally, it returns a JSON response with the updated user object.
 func UpdatePassword(c *fiber.Ctx) error {
-	var data = make(map[string]string)
-	if err := c.BodyParser(&data); err != nil {
+	var request dto.UpdatePasswordRequest
+	if err := validation.Parse(c, &request); err != nil {
 		return err
 	}
-	if data["password"] != data["password_confirm"] {
-		c.Status(fiber.StatusUnprocessableEntity)
-		return c.JSON(fiber.Map{
-			"message": "passwords do not match",
-		})
-	}
-	cookie := c.Cookies("jwt")
-	id, _ := utils.ParseJwt(cookie)
-	userId, _ := strconv.Atoi(*id)
 	user := models.User{
-		Id: uint(userId),
+		Id: middlewares.UserId(c),
+	}
+	if err := user.SetPassword(request.Password); err != nil {
+		return err
+	}
+	err := db.Session().Transaction(func(tx *gorm.DB) error {
+		if err := repositories.Users.Update(tx, &user); err != nil {
+			return err
+		}
+		return utils.RevokeUserSessions(tx, user.Id, middlewares.SessionId(c))
+	})
+	if err != nil {
+		return err
+	}
+	// The password itself is never recorded.
+	audit.Target(c, "users", user.Id)
+	user, err = repositories.Users.Get(db.Session(), models.Unrestricted, user.Id)
+	if err != nil {
+		return err
 	}
-	user.SetPassword(data["password"])
-	db.Session().Model(&user).Updates(user)
-	return c.JSON(user)
+	return c.JSON(dto.NewUserSelf(user))
 }
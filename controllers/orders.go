@@ -2,53 +2,46 @@ package controllers
 
 import (
 	"encoding/csv"
-	"os"
+	"io"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/lemadane/admin_backend_gofiber/db"
 	"github.com/lemadane/admin_backend_gofiber/middlewares"
 	"github.com/lemadane/admin_backend_gofiber/models"
+	"github.com/lemadane/admin_backend_gofiber/repositories"
 	"github.com/lemadane/admin_backend_gofiber/utils"
 )
 
 func AllOrders(context *fiber.Ctx) error {
-	if err := middlewares.IsAuthorized(context, "orders"); err != nil {
+	orderDto, err := utils.Paginate(context, db.Session(), repositories.Orders, middlewares.Scope(context))
+	if err != nil {
 		return err
 	}
-	page, _ := strconv.Atoi(context.Query("page", "1"))
-	orderDto := utils.Paginate(db.Session(), &models.Order{}, page)
 	return context.JSON(orderDto)
 }
 
+// Export sends the orders visible to the caller, with their items, as a CSV attachment.
+// The CSV is written straight into the response, so concurrent exports never share a file.
 func Export(context *fiber.Ctx) error {
-	if err := middlewares.IsAuthorized(context, "orders"); err != nil {
-		return err
-	}
-	filePath := "./csv/orders.csv"
-	if err := createFile(filePath); err != nil {
+	orders, err := repositories.Orders.List(db.Session(), middlewares.Scope(context), -1, -1)
+	if err != nil {
 		return err
 	}
-	return context.Download(filePath)
+	context.Attachment("orders.csv")
+	return writeOrders(context.Response().BodyWriter(), orders)
 }
 
-func createFile(filePath string) error {
-	file, err := os.Create(filePath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-	var orders []models.Order
-	db.Session().Preload("OrderItems").Find(&orders)
+// writeOrders writes the orders to output as CSV: a row per order, followed by a row per item.
+func writeOrders(output io.Writer, orders []models.Order) error {
+	writer := csv.NewWriter(output)
 	writer.Write([]string{
 		"ID", "Name", "Email", "Product Title", "Price", "Quantity",
 	})
 	for _, order := range orders {
 		data := []string{
 			strconv.Itoa(int(order.Id)),
-			order.Firstname + " " + order.Lastname,
+			order.Name,
 			order.Email,
 			"",
 			"",
@@ -74,5 +67,6 @@ func createFile(filePath string) error {
 		}
 	}
 
-	return nil
+	writer.Flush()
+	return writer.Error()
 }
@@ -1,14 +1,246 @@
 package controllers
 
 import (
+	"slices"
+	"sort"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/lemadane/admin_backend_gofiber/apierror"
+	"github.com/lemadane/admin_backend_gofiber/audit"
+	"github.com/lemadane/admin_backend_gofiber/authz"
 	"github.com/lemadane/admin_backend_gofiber/db"
+	"github.com/lemadane/admin_backend_gofiber/dto"
 	"github.com/lemadane/admin_backend_gofiber/models"
+	"github.com/lemadane/admin_backend_gofiber/repositories"
+	"github.com/lemadane/admin_backend_gofiber/utils"
+	"github.com/lemadane/admin_backend_gofiber/validation"
+	"gorm.io/gorm"
 )
 
 // AllPermissions retrieves all permissions from the database and returns them as JSON.
 func AllPermissions(context *fiber.Ctx) error {
-	permissions := make([]models.Permission, 0)
-	db.Session().Find(&permissions)
+	permissions, err := repositories.Permissions.List(db.Session().Order("id"), models.Unrestricted, -1, -1)
+	if err != nil {
+		return err
+	}
 	return context.JSON(permissions)
 }
+
+// PermissionMatrix returns all permissions grouped by category and resource and keyed by action,
+// in the format the role editor renders as a matrix. See dto.PermissionMatrix.
+// The columns are the actions that some permission grants, in the order of authz.Actions followed
+// by the wildcard, so that the matrix has no column of empty cells for actions that no route checks.
+func PermissionMatrix(context *fiber.Ctx) error {
+	permissions, err := repositories.Permissions.List(db.Session().Order("condition_name").Order("id"), models.Unrestricted, -1, -1)
+	if err != nil {
+		return err
+	}
+	matrix := dto.PermissionMatrix{
+		Actions: make([]string, 0, len(authz.Actions)+1),
+		Groups:  make([]dto.PermissionGroup, 0),
+	}
+
+	granted := map[string]bool{}
+	rows := map[string]*dto.PermissionRow{}
+	resourcesByCategory := map[string][]string{}
+	for _, permission := range permissions {
+		// Legacy permissions that could not be mapped to a resource have no place in the matrix.
+		if permission.Resource == "" {
+			continue
+		}
+		key := permission.Category + "\x00" + permission.Resource
+		row, ok := rows[key]
+		if !ok {
+			row = &dto.PermissionRow{
+				Resource: permission.Resource,
+				Cells:    map[string][]models.Permission{},
+			}
+			rows[key] = row
+			resourcesByCategory[permission.Category] = append(resourcesByCategory[permission.Category], permission.Resource)
+		}
+		row.Cells[permission.Action] = append(row.Cells[permission.Action], permission)
+		granted[permission.Action] = true
+	}
+	for _, action := range append(slices.Clone(authz.Actions), authz.Wildcard) {
+		if granted[string(action)] {
+			matrix.Actions = append(matrix.Actions, string(action))
+		}
+	}
+
+	categories := make([]string, 0, len(resourcesByCategory))
+	for category := range resourcesByCategory {
+		categories = append(categories, category)
+	}
+	// Categories are sorted by name, with uncategorized permissions last.
+	sort.Slice(categories, func(i, j int) bool {
+		if categories[i] == "" || categories[j] == "" {
+			return categories[j] == ""
+		}
+		return categories[i] < categories[j]
+	})
+	for _, category := range categories {
+		resources := resourcesByCategory[category]
+		sort.Slice(resources, func(i, j int) bool {
+			return resourceOrder(resources[i], resources[j])
+		})
+		group := dto.PermissionGroup{
+			Category:  category,
+			Resources: make([]dto.PermissionRow, len(resources)),
+		}
+		for i, resource := range resources {
+			group.Resources[i] = *rows[category+"\x00"+resource]
+		}
+		matrix.Groups = append(matrix.Groups, group)
+	}
+	return context.JSON(matrix)
+}
+
+// GetPermission retrieves a permission by ID and returns it as JSON.
+// It returns 400 for a malformed ID and 404 if the permission does not exist.
+func GetPermission(context *fiber.Ctx) error {
+	id, err := utils.ParamId(context, "id")
+	if err != nil {
+		return err
+	}
+	permission, err := repositories.Permissions.Get(db.Session(), models.Unrestricted, id)
+	if err != nil {
+		return err
+	}
+	return context.JSON(permission)
+}
+
+// CreatePermission creates a custom permission.
+// It parses and validates the request body as a CreatePermissionRequest. The resource must be a known
+// resource or "*", the action a known action or "*", and the condition, if any, must be registered for
+// the resource. The name is derived from the three, and the description defaults to one derived from them.
+// It returns 409 if an identical permission already exists, and the created permission as JSON otherwise.
+func CreatePermission(context *fiber.Ctx) error {
+	var request dto.CreatePermissionRequest
+	if err := validation.Parse(context, &request); err != nil {
+		return err
+	}
+	fields := map[string]string{}
+	if !authz.IsResource(request.Resource) {
+		fields["resource"] = "is not a known resource"
+	}
+	if !authz.IsAction(request.Action) {
+		fields["action"] = "is not a known action"
+	}
+	if request.Condition != "" && !authz.IsCondition(request.Resource, request.Condition) {
+		fields["condition"] = "is not a condition of the resource"
+	}
+	if len(fields) > 0 {
+		return apierror.Validation(fields)
+	}
+	action := authz.Action(request.Action)
+	permission := models.Permission{
+		Name:        authz.Name(request.Resource, action, request.Condition),
+		Resource:    request.Resource,
+		Action:      request.Action,
+		Condition:   request.Condition,
+		Description: request.Description,
+		Category:    request.Category,
+	}
+	if permission.Description == "" {
+		permission.Description = authz.Describe(request.Resource, action, request.Condition)
+	}
+	if permission.Category == "" {
+		permission.Category = authz.Categories[request.Resource]
+	}
+	if err := repositories.Permissions.Create(db.Session(), &permission); err != nil {
+		return err
+	}
+	audit.Target(context, "permissions", permission.Id)
+	audit.After(context, permission)
+	return context.JSON(permission)
+}
+
+// UpdatePermission updates the description and category of a permission.
+// What a permission grants cannot be changed; a different grant is a different permission.
+// It returns 400 for a malformed ID and 404 if the permission does not exist.
+// Finally, it returns the updated permission as JSON.
+func UpdatePermission(context *fiber.Ctx) error {
+	id, err := utils.ParamId(context, "id")
+	if err != nil {
+		return err
+	}
+	permission, err := repositories.Permissions.Get(db.Session(), models.Unrestricted, id)
+	if err != nil {
+		return err
+	}
+	var request dto.UpdatePermissionRequest
+	if err := validation.Parse(context, &request); err != nil {
+		return err
+	}
+	audit.Before(context, permission)
+	permission.Description = request.Description
+	permission.Category = request.Category
+	if err := repositories.Permissions.Update(db.Session(), &permission, "Description", "Category"); err != nil {
+		return err
+	}
+	audit.After(context, permission)
+	return context.JSON(permission)
+}
+
+// DeletePermission deletes a custom permission and revokes it from every role that holds it.
+// System permissions, created by the seed command, cannot be deleted and return 409.
+// The roles that held the permission, and the roles inheriting from them, get a new permissions
+// version so that cached permissions are dropped.
+// It returns 400 for a malformed ID and 404 if the permission does not exist.
+func DeletePermission(context *fiber.Ctx) error {
+	id, err := utils.ParamId(context, "id")
+	if err != nil {
+		return err
+	}
+	permission, err := repositories.Permissions.Get(db.Session(), models.Unrestricted, id)
+	if err != nil {
+		return err
+	}
+	if permission.System {
+		return apierror.Conflict("system permissions cannot be deleted")
+	}
+	affected := make([]uint, 0)
+	err = db.Session().Transaction(func(tx *gorm.DB) error {
+		var roleIds []uint
+		if err := tx.Table("role_permissions").Where("permission_id = ?", id).Pluck("role_id", &roleIds).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM role_permissions WHERE permission_id = ?", id).Error; err != nil {
+			return err
+		}
+		for _, roleId := range roleIds {
+			bumped, err := authz.BumpVersions(tx, roleId)
+			if err != nil {
+				return err
+			}
+			affected = append(affected, bumped...)
+		}
+		return repositories.Permissions.Delete(tx, &permission)
+	})
+	if err != nil {
+		return err
+	}
+	authz.InvalidateRole(affected...)
+	audit.Before(context, permission)
+	return context.Status(fiber.StatusNoContent).Send(nil)
+}
+
+// resourceOrder reports whether resource a is listed before resource b: known resources in the
+// order of authz.Resources, then others by name, and the wildcard last.
+func resourceOrder(a string, b string) bool {
+	rank := func(resource string) int {
+		if resource == authz.Wildcard {
+			return len(authz.Resources) + 1
+		}
+		for i, known := range authz.Resources {
+			if known == resource {
+				return i
+			}
+		}
+		return len(authz.Resources)
+	}
+	if rank(a) != rank(b) {
+		return rank(a) < rank(b)
+	}
+	return a < b
+}
@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"github.com/lemadane/admin_backend_gofiber/audit"
+	"github.com/lemadane/admin_backend_gofiber/db"
+	"github.com/lemadane/admin_backend_gofiber/dto"
+	"github.com/lemadane/admin_backend_gofiber/middlewares"
+	"github.com/lemadane/admin_backend_gofiber/models"
+	"github.com/lemadane/admin_backend_gofiber/repositories"
+	"github.com/lemadane/admin_backend_gofiber/utils"
+	"github.com/lemadane/admin_backend_gofiber/validation"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// AllProducts returns a paginated list of the products of the catalog.
+// See utils.Paginate for the pagination, sorting and filtering parameters.
+// Access to every handler in this file is guarded by the "products" policy in the route table.
+func AllProducts(context *fiber.Ctx) error {
+	page, err := utils.Paginate(context, db.Session(), repositories.Products, middlewares.Scope(context))
+	if err != nil {
+		return err
+	}
+	return context.JSON(page)
+}
+
+// GetProduct retrieves a product by ID and returns it as JSON,
+// with an ETag header that can be sent back in If-Match when updating the product.
+// It returns 400 for a malformed ID and 404 if the product does not exist.
+func GetProduct(context *fiber.Ctx) error {
+	id, err := utils.ParamId(context, "id")
+	if err != nil {
+		return err
+	}
+	product, err := repositories.Products.Get(db.Session(), middlewares.Scope(context), id)
+	if err != nil {
+		return err
+	}
+	if err := utils.SetETag(context, product); err != nil {
+		return err
+	}
+	return context.JSON(product)
+}
+
+// CreateProduct creates a product.
+// It parses and validates the request body as a ProductRequest and creates the product in the database.
+// It returns 409 if another product has the same SKU, and the created product as JSON otherwise.
+func CreateProduct(context *fiber.Ctx) error {
+	var request dto.ProductRequest
+	if err := validation.Parse(context, &request); err != nil {
+		return err
+	}
+	product := productFromRequest(request)
+	if err := repositories.Products.Create(db.Session(), &product); err != nil {
+		return err
+	}
+	audit.Target(context, "products", product.Id)
+	audit.After(context, product)
+	return context.JSON(product)
+}
+
+// UpdateProduct replaces the fields of a product with those of the request body, a ProductRequest.
+// It returns 400 for a malformed ID, 404 if the product does not exist, 412 if an If-Match header is sent
+// that does not match the product's current ETag and 409 if another product has the same SKU.
+// Finally, it returns the updated product as JSON.
+func UpdateProduct(context *fiber.Ctx) error {
+	id, err := utils.ParamId(context, "id")
+	if err != nil {
+		return err
+	}
+	scope := middlewares.Scope(context)
+	existing, err := repositories.Products.Get(db.Session(), scope, id)
+	if err != nil {
+		return err
+	}
+	if err := utils.CheckIfMatch(context, existing); err != nil {
+		return err
+	}
+	var request dto.ProductRequest
+	if err := validation.Parse(context, &request); err != nil {
+		return err
+	}
+	product := productFromRequest(request)
+	product.Id = id
+	if err := repositories.Products.Update(db.Session(), &product, "Title", "Description", "Image", "Price", "Sku", "Stock"); err != nil {
+		return err
+	}
+	product, err = repositories.Products.Get(db.Session(), scope, id)
+	if err != nil {
+		return err
+	}
+	if err := utils.SetETag(context, product); err != nil {
+		return err
+	}
+	audit.Before(context, existing)
+	audit.After(context, product)
+	return context.JSON(product)
+}
+
+// DeleteProduct deletes a product from the catalog.
+// The order items that refer to it keep their title and price, and no longer refer to a product.
+// It returns 400 for a malformed ID and 404 if the product does not exist.
+func DeleteProduct(context *fiber.Ctx) error {
+	id, err := utils.ParamId(context, "id")
+	if err != nil {
+		return err
+	}
+	product, err := repositories.Products.Get(db.Session(), middlewares.Scope(context), id)
+	if err != nil {
+		return err
+	}
+	err = db.Session().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.OrderItem{}).Where("product_id = ?", id).Update("product_id", nil).Error; err != nil {
+			return err
+		}
+		return repositories.Products.Delete(tx, &product)
+	})
+	if err != nil {
+		return err
+	}
+	audit.Before(context, product)
+	return context.Status(fiber.StatusNoContent).Send(nil)
+}
+
+// productFromRequest returns the product described by a validated ProductRequest.
+func productFromRequest(request dto.ProductRequest) models.Product {
+	return models.Product{
+		Title:       request.Title,
+		Description: request.Description,
+		Image:       request.Image,
+		Price:       request.Price,
+		Sku:         request.Sku,
+		Stock:       request.Stock,
+	}
+}
@@ -1,92 +1,394 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
 	"strconv"
 
+	"github.com/lemadane/admin_backend_gofiber/apierror"
+	"github.com/lemadane/admin_backend_gofiber/audit"
+	"github.com/lemadane/admin_backend_gofiber/authz"
+	"github.com/lemadane/admin_backend_gofiber/config"
 	"github.com/lemadane/admin_backend_gofiber/db"
-	"github.com/lemadane/admin_backend_gofiber/middlewares"
+	"github.com/lemadane/admin_backend_gofiber/dto"
 	"github.com/lemadane/admin_backend_gofiber/models"
+	"github.com/lemadane/admin_backend_gofiber/repositories"
+	"github.com/lemadane/admin_backend_gofiber/utils"
+	"github.com/lemadane/admin_backend_gofiber/validation"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // AllRoles is a handler function that returns all roles.
-// It checks if the user is authorized to access the "roles" resource,
-// and then retrieves all roles from the database and returns them as JSON.
+// It retrieves all roles, together with their permissions, from the database and returns them as JSON.
+// Access is guarded by the "roles" policy in the route table.
 func AllRoles(context *fiber.Ctx) error {
-	if err := middlewares.IsAuthorized(context, "roles"); err != nil {
+	roles, err := repositories.Roles.List(db.Session(), models.Unrestricted, -1, -1)
+	if err != nil {
 		return err
 	}
-	roles := make([]models.Role, 0)
-	db.Session().Find(&roles)
 	return context.JSON(roles)
 }
 
 // CreateRole creates a new role.
-// It checks if the user is authorized to perform this action using the "roles" permission.
-// It parses the request body into a fiber.Map object representing the role.
-// It creates the role in the database using the db.Session() method.
-// Finally, it returns the created role as a JSON response.
+// It parses and validates the request body as a RoleRequest, whose permission and parent IDs must exist;
+// a permission ID that does not exist returns a 422.
+// It creates the role together with its permissions in the database through the roles repository.
+// The role also inherits the permissions of its parent, if one is given.
+// Finally, it returns the created role, with its permissions, as a JSON response.
 func CreateRole(context *fiber.Ctx) error {
-	if err := middlewares.IsAuthorized(context, "roles"); err != nil {
+	var request dto.RoleRequest
+	if err := validation.Parse(context, &request); err != nil {
 		return err
 	}
-	var role fiber.Map
-	if err := context.BodyParser(&role); err != nil {
+	permissions, err := findPermissions(db.Session(), request.Permissions)
+	if err != nil {
+		return err
+	}
+	role := models.Role{
+		Name:        request.Name,
+		Level:       request.Level,
+		ParentId:    parentId(request.ParentId),
+		Permissions: permissions,
+	}
+	if err := repositories.Roles.Create(db.Session(), &role); err != nil {
+		return err
+	}
+	role, err = repositories.Roles.Get(db.Session(), models.Unrestricted, role.Id)
+	if err != nil {
+		return err
+	}
+	audit.Target(context, "roles", role.Id)
+	audit.After(context, role)
+	return context.JSON(role)
+}
+
+// GetRole retrieves a role by ID, together with its permissions, and returns it as JSON.
+// It sets an ETag header that can be sent back in If-Match when updating the role.
+// It returns 400 for a malformed ID and 404 if the role does not exist.
+func GetRole(context *fiber.Ctx) error {
+	id, err := utils.ParamId(context, "id")
+	if err != nil {
+		return err
+	}
+	role, err := repositories.Roles.Get(db.Session(), models.Unrestricted, id)
+	if err != nil {
+		return err
+	}
+	if err := utils.SetETag(context, role); err != nil {
 		return err
 	}
-	db.Session().Create(role)
 	return context.JSON(role)
 }
 
 // UpdateRole updates a role in the system.
-// It first checks if the user is authorized to perform the update operation.
-// Then, it parses the request body into a roleDto variable.
-// Next, it extracts the permissions from the roleDto and converts them into models.Permission objects.
-// After that, it deletes the existing role permissions from the database for the given role ID.
-// Finally, it updates the role in the database with the new information and returns the updated role as JSON.
-// If any error occurs during the process, it is returned as an error response.
+// It returns 400 for a malformed ID, 404 if the role does not exist, and 412 if an If-Match
+// header is sent that does not match the role's current ETag.
+// Then, it parses and validates the request body as a RoleRequest.
+// The update runs in a single transaction, which locks the role where the database supports it and
+// repeats the If-Match check, so that concurrent updates cannot interleave. Inside it, the update
+// returns a 422 if the new parent would make the role its own ancestor or if a permission ID does not
+// exist, and replaces the role's permissions by adding and removing only the ones that changed.
+// When the permissions or the parent change, the permissions version of the role and of every role
+// inheriting from it is bumped so that cached permissions are dropped.
+// Finally, it returns the updated role as JSON, together with the added and removed permissions.
+// If any error occurs during the process, the transaction is rolled back and the error is returned.
 func UpdateRole(context *fiber.Ctx) error {
-	if err := middlewares.IsAuthorized(context, "roles"); err != nil {
+	id, err := utils.ParamId(context, "id")
+	if err != nil {
+		return err
+	}
+	existing, err := repositories.Roles.Get(db.Session(), models.Unrestricted, id)
+	if err != nil {
 		return err
 	}
-	var roleDto fiber.Map
-	if err := context.BodyParser(&roleDto); err != nil {
+	if err := utils.CheckIfMatch(context, existing); err != nil {
 		return err
 	}
-	list := roleDto["permissions"].([]interface{})
-	permissions := make([]models.Permission, len(list))
-	for i, permissionId := range list {
-		id, _ := permissionId.(uint)
-		permissions[i] = models.Permission{
-			Id: uint(id),
+	var request dto.RoleRequest
+	if err := validation.Parse(context, &request); err != nil {
+		return err
+	}
+	var update dto.RoleUpdate
+	var affected []uint
+	err = db.Session().Transaction(func(tx *gorm.DB) error {
+		current := models.Role{
+			Id: id,
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Permissions").First(&current, id).Error; err != nil {
+			return err
+		}
+		if err := utils.CheckIfMatch(context, current); err != nil {
+			return err
+		}
+		if request.ParentId != 0 {
+			err := authz.CheckParent(tx, id, request.ParentId)
+			if errors.Is(err, authz.ErrRoleCycle) {
+				return apierror.Validation(map[string]string{
+					"parent_id": "would create a cycle in the role hierarchy",
+				})
+			}
+			if err != nil {
+				return err
+			}
+		}
+		permissions, err := findPermissions(tx, request.Permissions)
+		if err != nil {
+			return err
 		}
+		update.Added, update.Removed = diffPermissions(current.Permissions, permissions)
+		parentChanged := !sameParent(current.ParentId, parentId(request.ParentId))
+
+		role := models.Role{
+			Id:       id,
+			Name:     request.Name,
+			Level:    request.Level,
+			ParentId: parentId(request.ParentId),
+		}
+		if err := repositories.Roles.Update(tx, &role, "Name", "Level", "ParentId"); err != nil {
+			return err
+		}
+		if len(update.Removed) > 0 {
+			removed := make([]uint, len(update.Removed))
+			for i, permission := range update.Removed {
+				removed[i] = permission.Id
+			}
+			err := tx.Where("role_id = ? AND permission_id IN ?", id, removed).Delete(&models.RolePermission{}).Error
+			if err != nil {
+				return err
+			}
+		}
+		if len(update.Added) > 0 {
+			added := make([]models.RolePermission, len(update.Added))
+			for i, permission := range update.Added {
+				added[i] = models.RolePermission{RoleId: id, PermissionId: permission.Id}
+			}
+			if err := tx.Create(&added).Error; err != nil {
+				return err
+			}
+		}
+		if len(update.Added) > 0 || len(update.Removed) > 0 || parentChanged {
+			if affected, err = authz.BumpVersions(tx, id); err != nil {
+				return err
+			}
+		}
+		update.Role, err = repositories.Roles.Get(tx, models.Unrestricted, id)
+		return err
+	})
+	if err != nil {
+		return err
 	}
-	id, _ := strconv.Atoi(context.Params("id"))
-	var result interface{}
-	db.Session().Table("role_permissions").Where("role_id", id).Delete(&result)
-	role := models.Role{
-		Id:          uint(id),
-		Name:        roleDto["name"].(string),
-		Permissions: permissions,
+	authz.InvalidateRole(affected...)
+	if err := utils.SetETag(context, update.Role); err != nil {
+		return err
 	}
-	db.Session().Model(&role).Updates(role)
-	return context.JSON(role)
+	audit.Before(context, existing)
+	audit.After(context, update.Role)
+	return context.JSON(update)
 }
 
 // DeleteRole deletes a role based on the provided ID.
-// It first checks if the user is authorized to perform this action using the "roles" permission.
-// If the user is authorized, it retrieves the ID from the request parameters and converts it to an integer.
-// Then, it creates a Role struct with the retrieved ID.
-// Finally, it deletes the role from the database and returns a response with a status code of 204 (No Content).
+// It parses the ID from the request parameters and checks that the role exists.
+// System roles, such as the admin role and the role granted on registration, cannot be deleted and return 409.
+// Deleting a role that users hold also returns 409, unless the reassign_to query parameter names another
+// role, which is then granted to every such user who does not hold it yet; a reassign_to role that does
+// not exist returns 422. The reassignment is recorded in the audit log.
+// Roles that inherited from the deleted role inherit from its parent instead.
+// The role's permission and user assignments are deleted together with it, in a single transaction.
+// Finally, it returns a response with a status code of 204 (No Content).
+// It returns 400 for a malformed ID and 404 if the role does not exist.
 func DeleteRole(context *fiber.Ctx) error {
-	if err := middlewares.IsAuthorized(context, "roles"); err != nil {
+	id, err := utils.ParamId(context, "id")
+	if err != nil {
 		return err
 	}
-	id, _ := strconv.Atoi(context.Params("id"))
-	role := models.Role{
-		Id: uint(id),
+	reassignTo, err := reassignTarget(context, id)
+	if err != nil {
+		return err
+	}
+	role, err := repositories.Roles.Get(db.Session(), models.Unrestricted, id)
+	if err != nil {
+		return err
+	}
+	if role.System || role.Name == config.Get().Auth.RegistrationRole {
+		return apierror.Conflict("system roles cannot be deleted")
+	}
+	var affected, holders []uint
+	err = db.Session().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.UserRole{}).Where("role_id = ?", id).Pluck("user_id", &holders).Error; err != nil {
+			return err
+		}
+		if len(holders) > 0 {
+			if reassignTo == 0 {
+				return apierror.Conflict(fmt.Sprintf("the role is held by %d users; pass reassign_to to move them to another role", len(holders)))
+			}
+			if err := reassignRole(tx, context, id, reassignTo, holders); err != nil {
+				return err
+			}
+		}
+		var err error
+		if affected, err = authz.BumpVersions(tx, id); err != nil {
+			return err
+		}
+		err = tx.Model(&models.Role{}).Where("parent_id = ?", id).Update("parent_id", role.ParentId).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("role_id = ?", id).Delete(&models.UserRole{}).Error; err != nil {
+			return err
+		}
+		return repositories.Roles.Delete(tx, &role)
+	})
+	if err != nil {
+		return err
+	}
+	authz.InvalidateRole(affected...)
+	for _, userId := range holders {
+		authz.InvalidateUser(userId)
 	}
-	db.Session().Delete(&role)
+	audit.Before(context, role)
 	return context.Status(fiber.StatusNoContent).Send(nil)
 }
+
+// RolePermissions returns the effective permissions of a role: those assigned to it and those it
+// inherits from its ancestors. Each permission names the role it is assigned to in granted_by.
+// It returns 400 for a malformed ID and 404 if the role does not exist.
+func RolePermissions(context *fiber.Ctx) error {
+	id, err := utils.ParamId(context, "id")
+	if err != nil {
+		return err
+	}
+	permissions, err := authz.EffectivePermissions(db.Session(), id)
+	if err != nil {
+		return err
+	}
+	return context.JSON(permissions)
+}
+
+// reassignTarget returns the ID of the role named by the reassign_to query parameter, or zero if it is absent.
+// It returns a 422 API error if the parameter is malformed, names the role being deleted, or names a role
+// that does not exist.
+func reassignTarget(context *fiber.Ctx, id uint) (uint, error) {
+	value := context.Query("reassign_to")
+	if value == "" {
+		return 0, nil
+	}
+	target, err := strconv.ParseUint(value, 10, 0)
+	if err != nil || target == 0 {
+		return 0, apierror.Validation(map[string]string{"reassign_to": "must be a role ID"})
+	}
+	if uint(target) == id {
+		return 0, apierror.Validation(map[string]string{"reassign_to": "must be another role"})
+	}
+	var found int64
+	if err := db.Session().Model(&models.Role{}).Where("id = ?", target).Count(&found).Error; err != nil {
+		return 0, err
+	}
+	if found == 0 {
+		return 0, apierror.Validation(map[string]string{"reassign_to": "does not exist"})
+	}
+	return uint(target), nil
+}
+
+// reassignRole grants the role with ID to to the given holders of the role with ID from who do not hold it yet,
+// and records each reassignment in the audit log.
+func reassignRole(tx *gorm.DB, context *fiber.Ctx, from uint, to uint, holders []uint) error {
+	var holding []uint
+	if err := tx.Model(&models.UserRole{}).Where("role_id = ? AND user_id IN ?", to, holders).Pluck("user_id", &holding).Error; err != nil {
+		return err
+	}
+	holdsTarget := make(map[uint]bool, len(holding))
+	for _, userId := range holding {
+		holdsTarget[userId] = true
+	}
+	for _, userId := range holders {
+		if !holdsTarget[userId] {
+			if err := tx.Create(&models.UserRole{UserId: userId, RoleId: to}).Error; err != nil {
+				return err
+			}
+		}
+		before := fiber.Map{"role_id": from}
+		after := fiber.Map{"role_id": to}
+		if err := audit.Record(tx, context, "users.roles.reassign", "users", userId, before, after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parentId converts the parent ID of a request into the nullable column value, where zero means no parent.
+func parentId(id uint) *uint {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
+
+// findPermissions loads the permissions with the given IDs, ignoring duplicates.
+// It returns a 422 API error naming every ID that does not exist.
+func findPermissions(tx *gorm.DB, ids []uint) ([]models.Permission, error) {
+	permissions := make([]models.Permission, 0, len(ids))
+	if len(ids) == 0 {
+		return permissions, nil
+	}
+	if err := tx.Where("id IN ?", ids).Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+	found := make(map[uint]bool, len(permissions))
+	for _, permission := range permissions {
+		found[permission.Id] = true
+	}
+	if err := checkFound("permissions", ids, found); err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+// checkFound returns a 422 API error naming, as elements of the request field, every ID in ids
+// that is not in found, or nil if all of them are.
+func checkFound(field string, ids []uint, found map[uint]bool) error {
+	fields := map[string]string{}
+	for i, id := range ids {
+		if !found[id] {
+			fields[fmt.Sprintf("%s[%d]", field, i)] = "does not exist"
+		}
+	}
+	if len(fields) > 0 {
+		return apierror.Validation(fields)
+	}
+	return nil
+}
+
+// diffPermissions returns the permissions in next that are not in current, and those in current
+// that are not in next.
+func diffPermissions(current []models.Permission, next []models.Permission) ([]models.Permission, []models.Permission) {
+	inCurrent := make(map[uint]bool, len(current))
+	for _, permission := range current {
+		inCurrent[permission.Id] = true
+	}
+	inNext := make(map[uint]bool, len(next))
+	added := make([]models.Permission, 0)
+	for _, permission := range next {
+		inNext[permission.Id] = true
+		if !inCurrent[permission.Id] {
+			added = append(added, permission)
+		}
+	}
+	removed := make([]models.Permission, 0)
+	for _, permission := range current {
+		if !inNext[permission.Id] {
+			removed = append(removed, permission)
+		}
+	}
+	return added, removed
+}
+
+// sameParent reports whether two nullable parent IDs are equal.
+func sameParent(a *uint, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
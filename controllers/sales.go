@@ -3,20 +3,24 @@ package controllers
 import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/lemadane/admin_backend_gofiber/db"
+	"github.com/lemadane/admin_backend_gofiber/middlewares"
 	"github.com/lemadane/admin_backend_gofiber/models"
 )
 
 // Chart generates a chart of sales data.
-// It retrieves sales data from the database and returns it as JSON.
+// It retrieves the daily sales totals from the database and returns them as JSON.
+// The date expression is chosen for the dialect of the connected database.
+// Only the orders visible to the caller are included in the totals, and without any it returns an empty list.
 func Chart(context *fiber.Ctx) error {
-	var sales []models.Sales
-	println(context.Method())
-
-	db.Session().Raw(`
-		SELECT DATE_FORMAT(o.created_at, '%Y-%m-%d') as date, SUM(oi.price * oi.quantity) as sum
-		FROM orders o
-		JOIN order_items oi on o.id = oi.order_id
-		GROUP BY date
-	`).Scan(&sales)
+	sales := []models.Sales{}
+	err := db.Session().Table("orders").
+		Select(db.DateFormat("orders.created_at") + " as date, SUM(order_items.price * order_items.quantity) as sum").
+		Joins("JOIN order_items on orders.id = order_items.order_id").
+		Scopes(middlewares.Scope(context)).
+		Group("date").
+		Scan(&sales).Error
+	if err != nil {
+		return err
+	}
 	return context.JSON(sales)
 }
@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lemadane/admin_backend_gofiber/apierror"
+	"github.com/lemadane/admin_backend_gofiber/authz"
+	"github.com/lemadane/admin_backend_gofiber/db"
+	"github.com/lemadane/admin_backend_gofiber/dto"
+	"github.com/lemadane/admin_backend_gofiber/middlewares"
+	"github.com/lemadane/admin_backend_gofiber/search"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Bounds of the search query parameters.
+const (
+	minSearchLength    = 2
+	maxSearchLength    = 100
+	defaultSearchLimit = 5
+	maxSearchLimit     = 50
+)
+
+// Search finds users and orders by partial name, email, phone number or product title, e.g.
+// /search?q=jane+acme, and returns them grouped by type, the best matches first.
+// The query is split into terms at spaces, and an entity matches if each term is found, ignoring case,
+// in one of its fields; see the search package for the ranking. The query parameters are:
+//
+//	q      the query, of 2 to 100 characters
+//	types  a comma-separated list of the types to search, "users" and "orders"; all of them by default
+//	limit  the number of results of each type, 5 by default and at most 50
+//
+// Only the types that the user may list are searched, within the rows that their permissions allow,
+// and the user must be allowed to list at least one of them.
+// It returns a 422 if a parameter is invalid and a 403 if no type may be searched.
+func Search(context *fiber.Ctx) error {
+	query := strings.TrimSpace(context.Query("q"))
+	fields := map[string]string{}
+	if length := utf8.RuneCountInString(query); length < minSearchLength || length > maxSearchLength {
+		fields["q"] = fmt.Sprintf("must be between %d and %d characters", minSearchLength, maxSearchLength)
+	}
+	limit, err := strconv.Atoi(context.Query("limit", strconv.Itoa(defaultSearchLimit)))
+	if err != nil || limit < 1 || limit > maxSearchLimit {
+		fields["limit"] = fmt.Sprintf("must be an integer between 1 and %d", maxSearchLimit)
+	}
+	kinds, err := searchKinds(context.Query("types"))
+	if err != nil {
+		fields["types"] = err.Error()
+	}
+	if len(fields) > 0 {
+		return apierror.Validation(fields)
+	}
+
+	terms := search.Terms(query)
+	response := dto.SearchResponse{Query: query, Groups: make([]dto.SearchGroup, 0)}
+	permitted := false
+	for _, kind := range kinds {
+		scope, allowed, err := middlewares.Permitted(context, kind.Type, authz.ActionList)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			continue
+		}
+		permitted = true
+		results, err := search.Current().Search(db.Session(), kind, terms, scope)
+		if err != nil {
+			return err
+		}
+		response.Groups = append(response.Groups, dto.SearchGroup{
+			Type:    kind.Type,
+			Total:   len(results),
+			Results: results[:min(limit, len(results))],
+		})
+	}
+	if !permitted {
+		return apierror.Forbidden("Not authorized")
+	}
+	return context.JSON(response)
+}
+
+// searchKinds returns the kinds named by the types query parameter, or all of them if it is empty.
+func searchKinds(types string) ([]*search.Kind, error) {
+	if types == "" {
+		return search.Kinds, nil
+	}
+	requested := map[string]bool{}
+	for _, name := range strings.Split(types, ",") {
+		requested[strings.TrimSpace(name)] = true
+	}
+	kinds := make([]*search.Kind, 0)
+	names := make([]string, 0, len(search.Kinds))
+	for _, kind := range search.Kinds {
+		names = append(names, kind.Type)
+		if requested[kind.Type] {
+			kinds = append(kinds, kind)
+			delete(requested, kind.Type)
+		}
+	}
+	for name := range requested {
+		return nil, fmt.Errorf("cannot search %q; allowed are %s", name, strings.Join(names, ", "))
+	}
+	return kinds, nil
+}
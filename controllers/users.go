@@ -1,93 +1,338 @@
 package controllers
 
 import (
-	"strconv"
-
 	"github.com/gofiber/fiber/v2"
+	"github.com/lemadane/admin_backend_gofiber/apierror"
+	"github.com/lemadane/admin_backend_gofiber/audit"
+	"github.com/lemadane/admin_backend_gofiber/authz"
 	"github.com/lemadane/admin_backend_gofiber/db"
+	"github.com/lemadane/admin_backend_gofiber/dto"
 	"github.com/lemadane/admin_backend_gofiber/middlewares"
 	"github.com/lemadane/admin_backend_gofiber/models"
+	"github.com/lemadane/admin_backend_gofiber/repositories"
 	"github.com/lemadane/admin_backend_gofiber/utils"
+	"github.com/lemadane/admin_backend_gofiber/validation"
+	"gorm.io/gorm"
 )
 
 // AllUsers returns a list of all users.
-// It checks if the user is authorized to access the "users" resource,
-// retrieves the page number from the query parameters, and returns
+// It selects the page from the query parameters, as described by utils.Paginate, and returns
 // a JSON response with the paginated list of users.
+// Access to every handler in this file is guarded by the "users" policy in the route table,
+// and only the users covered by the row-level conditions of the caller's permissions are visible.
 func AllUsers(context *fiber.Ctx) error {
-	if err := middlewares.IsAuthorized(context, "users"); err != nil {
+	page, err := utils.Paginate(context, db.Session(), repositories.Users, middlewares.Scope(context))
+	if err != nil {
 		return err
 	}
-	pageNum, _ := strconv.Atoi(context.Query("page", "1"))
-	return context.JSON(utils.Paginate(db.Session(), &models.User{}, pageNum))
+	return context.JSON(fiber.Map{
+		"data": dto.NewUserAdminList(page.Data),
+		"meta": page.Meta,
+	})
 }
 
 // GetUser retrieves a user by ID and returns it as JSON.
-// It first checks if the user is authorized to access this endpoint.
-// If the user is authorized, it fetches the user from the database and returns it as JSON.
-// If there is an error during authorization or fetching the user, it returns the error.
+// It fetches the user from the database and returns it as JSON,
+// with an ETag header that can be sent back in If-Match when updating the user.
+// It returns 400 for a malformed ID and 404 if the user does not exist or is not visible to the caller.
 func GetUser(context *fiber.Ctx) error {
-	if err := middlewares.IsAuthorized(context, "users"); err != nil {
+	id, err := utils.ParamId(context, "id")
+	if err != nil {
 		return err
 	}
-	id, _ := strconv.Atoi(context.Params("id"))
-	user := models.User{
-		Id: uint(id),
+	user, err := repositories.Users.Get(db.Session(), middlewares.Scope(context), id)
+	if err != nil {
+		return err
+	}
+	view := dto.NewUserAdmin(user)
+	if err := utils.SetETag(context, view); err != nil {
+		return err
+	}
+	return context.JSON(view)
+}
+
+// GetUserProfile returns the public profile of a user by ID, as JSON.
+// Any authenticated user may see the profile of any user, so the row-level conditions of the
+// caller's permissions do not apply; the profile only holds the user's name.
+// It returns 400 for a malformed ID and 404 if the user does not exist.
+func GetUserProfile(context *fiber.Ctx) error {
+	id, err := utils.ParamId(context, "id")
+	if err != nil {
+		return err
 	}
-	db.Session().Find(&user)
-	return context.JSON(user)
+	user, err := repositories.Users.Get(db.Session(), models.Unrestricted, id)
+	if err != nil {
+		return err
+	}
+	return context.JSON(dto.NewUserProfile(user))
 }
 
 // CreateUser creates a new user.
-// It first checks if the user is authorized to create users.
-// Then it parses the request body into a new User object.
-// It sets the password for the user and creates the user in the database.
+// It parses and validates the request body as a CreateUserRequest; a role ID that does not exist returns a 422.
+// It sets the password for the user and creates the user, together with the roles it is granted,
+// in the database. The user and each granted role are recorded in the audit log.
 // Finally, it returns the created user as a JSON response.
 func CreateUser(context *fiber.Ctx) error {
-	if err := middlewares.IsAuthorized(context, "users"); err != nil {
+	var request dto.CreateUserRequest
+	if err := validation.Parse(context, &request); err != nil {
 		return err
 	}
-	user := new(models.User)
-	if err := context.BodyParser(&user); err != nil {
+	roles, err := findRoles(db.Session(), request.RoleIds)
+	if err != nil {
 		return err
 	}
-	user.SetPassword(user.Password)
-	db.Session().Create(user)
-	return context.JSON(user)
+	user := models.User{
+		Firstname: request.Firstname,
+		Lastname:  request.Lastname,
+		Email:     request.Email,
+		PhoneNo:   request.PhoneNo,
+		Region:    request.Region,
+		Roles:     roles,
+	}
+	if err := user.SetPassword(request.Password); err != nil {
+		return err
+	}
+	err = db.Session().Transaction(func(tx *gorm.DB) error {
+		if err := repositories.Users.Create(tx, &user); err != nil {
+			return err
+		}
+		for _, role := range roles {
+			after := fiber.Map{"role_id": role.Id}
+			if err := audit.Record(tx, context, "users.roles.grant", "users", user.Id, nil, after); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	user, err = repositories.Users.Get(db.Session(), models.Unrestricted, user.Id)
+	if err != nil {
+		return err
+	}
+	view := dto.NewUserAdmin(user)
+	audit.Target(context, "users", user.Id)
+	audit.After(context, view)
+	return context.JSON(view)
 }
 
 // UpdateUser updates a user's information based on the provided ID.
-// It first checks if the user is authorized to perform the update.
-// Then, it parses the request body into a User struct and updates the corresponding record in the database.
+// It returns 400 for a malformed ID, 404 if the user does not exist or is not visible to the caller,
+// and 412 if an If-Match header is sent that does not match the user's current ETag.
+// Then, it parses and validates the request body as an UpdateUserRequest and updates the
+// corresponding record in the database. Omitted fields are left unchanged.
+// An email taken by another user is reported as a validation error of the email field.
+// The update is rolled back with a 403 if it would move the user out of the rows the caller
+// may update, e.g. by moving them to another region.
 // Finally, it returns the updated user information as a JSON response.
 func UpdateUser(context *fiber.Ctx) error {
-	if err := middlewares.IsAuthorized(context, "users"); err != nil {
+	id, err := utils.ParamId(context, "id")
+	if err != nil {
+		return err
+	}
+	scope := middlewares.Scope(context)
+	existing, err := repositories.Users.Get(db.Session(), scope, id)
+	if err != nil {
+		return err
+	}
+	if err := utils.CheckIfMatch(context, dto.NewUserAdmin(existing)); err != nil {
+		return err
+	}
+	var request dto.UpdateUserRequest
+	if err := validation.Parse(context, &request); err != nil {
 		return err
 	}
-	id, _ := strconv.Atoi(context.Params("id"))
 	user := models.User{
-		Id: uint(id),
+		Id:        id,
+		Firstname: request.Firstname,
+		Lastname:  request.Lastname,
+		Email:     request.Email,
+		PhoneNo:   request.PhoneNo,
+		Region:    request.Region,
 	}
-	if err := context.BodyParser(&user); err != nil {
+	err = db.Session().Transaction(func(tx *gorm.DB) error {
+		if err := repositories.Users.Update(tx, &user); err != nil {
+			return err
+		}
+		return checkVisible(tx, scope, id)
+	})
+	if err != nil {
+		return validation.Taken(err, "email")
+	}
+	user, err = repositories.Users.Get(db.Session(), scope, id)
+	if err != nil {
 		return err
 	}
-	db.Session().Model(&user).Updates(user)
-	return context.JSON(user)
+	view := dto.NewUserAdmin(user)
+	if err := utils.SetETag(context, view); err != nil {
+		return err
+	}
+	audit.Before(context, dto.NewUserAdmin(existing))
+	audit.After(context, view)
+	return context.JSON(view)
 }
 
 // DeleteUser deletes a user from the database.
-// It first checks if the user is authorized to perform this action.
-// Then it retrieves the user ID from the request parameters and converts it to an integer.
-// It creates a new User struct with the retrieved ID.
-// Finally, it deletes the user from the database and returns a JSON response with a success message.
+// It parses the user ID from the request parameters and checks that the user exists.
+// Finally, it deletes the user, together with their role assignments, from the database, revokes their sessions
+// and returns a response with a status code of 204 (No Content).
+// It returns 400 for a malformed ID and 404 if the user does not exist or is not visible to the caller.
 func DeleteUser(context *fiber.Ctx) error {
-	if err := middlewares.IsAuthorized(context, "users"); err != nil {
+	id, err := utils.ParamId(context, "id")
+	if err != nil {
 		return err
 	}
-	id, _ := strconv.Atoi(context.Params("id"))
-	user := models.User{
-		Id: uint(id),
+	user, err := repositories.Users.Get(db.Session(), middlewares.Scope(context), id)
+	if err != nil {
+		return err
+	}
+	err = db.Session().Transaction(func(tx *gorm.DB) error {
+		if err := repositories.Users.Delete(tx, &user); err != nil {
+			return err
+		}
+		return utils.RevokeUserSessions(tx, id, "")
+	})
+	if err != nil {
+		return err
 	}
-	db.Session().Delete(&user)
+	authz.InvalidateUser(id)
+	audit.Before(context, dto.NewUserAdmin(user))
 	return context.Status(fiber.StatusNoContent).Send(nil)
 }
+
+// GrantRole grants a role to a user.
+// It parses and validates the request body as a GrantRoleRequest and adds the role to the user's roles,
+// recording the change in the audit log. Granting a role the user already holds changes nothing.
+// It returns 400 for a malformed ID and 404 if the user does not exist or is not visible to the caller.
+// The grant is rolled back with a 403 if it would move the user out of the rows the caller may update,
+// e.g. by promoting them to a role the caller does not outrank.
+// Finally, it returns the updated user as JSON.
+func GrantRole(context *fiber.Ctx) error {
+	id, err := utils.ParamId(context, "id")
+	if err != nil {
+		return err
+	}
+	scope := middlewares.Scope(context)
+	user, err := repositories.Users.Get(db.Session(), scope, id)
+	if err != nil {
+		return err
+	}
+	var request dto.GrantRoleRequest
+	if err := validation.Parse(context, &request); err != nil {
+		return err
+	}
+	if !holdsRole(user, request.RoleId) {
+		before := fiber.Map{"role_ids": user.RoleIds()}
+		err = db.Session().Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&models.UserRole{UserId: id, RoleId: request.RoleId}).Error; err != nil {
+				return err
+			}
+			if err := checkVisible(tx, scope, id); err != nil {
+				return err
+			}
+			after := fiber.Map{"role_ids": append(user.RoleIds(), request.RoleId)}
+			return audit.Record(tx, context, "users.roles.grant", "users", id, before, after)
+		})
+		if err != nil {
+			return err
+		}
+		authz.InvalidateUser(id)
+	}
+	user, err = repositories.Users.Get(db.Session(), scope, id)
+	if err != nil {
+		return err
+	}
+	return context.JSON(dto.NewUserAdmin(user))
+}
+
+// RevokeRole revokes a role from a user, recording the change in the audit log.
+// It returns 400 for malformed IDs, and 404 if the user does not exist, is not visible to the caller,
+// or does not hold the role.
+// Finally, it returns the updated user as JSON.
+func RevokeRole(context *fiber.Ctx) error {
+	id, err := utils.ParamId(context, "id")
+	if err != nil {
+		return err
+	}
+	roleId, err := utils.ParamId(context, "roleId")
+	if err != nil {
+		return err
+	}
+	scope := middlewares.Scope(context)
+	user, err := repositories.Users.Get(db.Session(), scope, id)
+	if err != nil {
+		return err
+	}
+	if !holdsRole(user, roleId) {
+		return apierror.NotFound("the user does not hold this role")
+	}
+	before := fiber.Map{"role_ids": user.RoleIds()}
+	err = db.Session().Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ? AND role_id = ?", id, roleId).Delete(&models.UserRole{}).Error
+		if err != nil {
+			return err
+		}
+		remaining := make([]uint, 0, len(user.Roles))
+		for _, role := range user.Roles {
+			if role.Id != roleId {
+				remaining = append(remaining, role.Id)
+			}
+		}
+		after := fiber.Map{"role_ids": remaining}
+		return audit.Record(tx, context, "users.roles.revoke", "users", id, before, after)
+	})
+	if err != nil {
+		return err
+	}
+	authz.InvalidateUser(id)
+	user, err = repositories.Users.Get(db.Session(), models.Unrestricted, id)
+	if err != nil {
+		return err
+	}
+	return context.JSON(dto.NewUserAdmin(user))
+}
+
+// checkVisible returns a 403 API error if the user with the given ID is outside of scope.
+// It is used after a change, inside its transaction, so that a caller cannot move a row out of
+// the rows they may change.
+func checkVisible(tx *gorm.DB, scope models.Scope, id uint) error {
+	var visible int64
+	if err := tx.Model(&models.User{}).Scopes(scope).Where("users.id = ?", id).Count(&visible).Error; err != nil {
+		return err
+	}
+	if visible == 0 {
+		return apierror.Forbidden("Not authorized")
+	}
+	return nil
+}
+
+// holdsRole reports whether the user holds the role.
+func holdsRole(user models.User, roleId uint) bool {
+	for _, role := range user.Roles {
+		if role.Id == roleId {
+			return true
+		}
+	}
+	return false
+}
+
+// findRoles loads the roles with the given IDs, ignoring duplicates.
+// It returns a 422 API error naming every ID that does not exist.
+func findRoles(tx *gorm.DB, ids []uint) ([]models.Role, error) {
+	roles := make([]models.Role, 0, len(ids))
+	if len(ids) == 0 {
+		return roles, nil
+	}
+	if err := tx.Where("id IN ?", ids).Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	found := make(map[uint]bool, len(roles))
+	for _, role := range roles {
+		found[role.Id] = true
+	}
+	if err := checkFound("role_ids", ids, found); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
@@ -1,28 +1,73 @@
 package db
 
 import (
+	"fmt"
+
+	"github.com/lemadane/admin_backend_gofiber/config"
+
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
+// Supported database drivers.
+const (
+	MySQL    = "mysql"
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
 // ormDb is a global variable that holds the connection to the database.
 var ormDb *gorm.DB
 
-// Connect establishes a connection to the database.
-func Connect() {
-	db, err := gorm.Open(
-		mysql.Open(
-			"root:mel@tcp(localhost:3306)/mysql?charset=utf8&parseTime=True&loc=Local",
-		),
-		&gorm.Config{},
-	)
+// Connect establishes a connection to the configured database.
+// The driver is selected by cfg.Driver and the connection string is passed to it unchanged.
+func Connect(cfg config.Database) error {
+	dialector, err := Dialector(cfg)
+	if err != nil {
+		return err
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{
+		// Translate driver errors into gorm.ErrDuplicatedKey and friends,
+		// so that callers can map them onto API errors independently of the driver.
+		TranslateError: true,
+	})
 	if err != nil {
-		panic(err.Error())
+		return err
 	}
 	ormDb = db
+	return nil
+}
+
+// Dialector returns the gorm dialector for the configured driver.
+func Dialector(cfg config.Database) (gorm.Dialector, error) {
+	switch cfg.Driver {
+	case MySQL:
+		return mysql.Open(cfg.DSN), nil
+	case Postgres:
+		return postgres.Open(cfg.DSN), nil
+	case SQLite:
+		return sqlite.Open(cfg.DSN), nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", cfg.Driver)
+	}
 }
 
 // Session returns the global database connection.
 func Session() *gorm.DB {
 	return ormDb
 }
+
+// DateFormat returns a SQL expression that formats the given date column as YYYY-MM-DD
+// in the dialect of the connected database.
+func DateFormat(column string) string {
+	switch ormDb.Dialector.Name() {
+	case Postgres:
+		return fmt.Sprintf("TO_CHAR(%s, 'YYYY-MM-DD')", column)
+	case SQLite:
+		return fmt.Sprintf("strftime('%%Y-%%m-%%d', %s)", column)
+	default:
+		return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-%%d')", column)
+	}
+}
@@ -0,0 +1,32 @@
+package dto
+
+// RegisterRequest is the body of POST /register.
+type RegisterRequest struct {
+	Firstname       string `json:"firstname" validate:"required,max=255"`
+	Lastname        string `json:"lastname" validate:"max=255"`
+	Email           string `json:"email" validate:"required,email,max=191,unique=users.email"`
+	PhoneNo         string `json:"phone_no" validate:"max=32"`
+	Password        string `json:"password" validate:"required,password,bcrypt"`
+	PasswordConfirm string `json:"password_confirm" validate:"required,eqfield=Password"`
+}
+
+// LoginRequest is the body of POST /login.
+type LoginRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+// UpdateInfoRequest is the body of PUT /users/info.
+// Omitted fields are left unchanged.
+type UpdateInfoRequest struct {
+	Firstname string `json:"first_name" validate:"max=255"`
+	Lastname  string `json:"last_name" validate:"max=255"`
+	Email     string `json:"email" validate:"omitempty,email,max=191"`
+	PhoneNo   string `json:"phone_no" validate:"max=32"`
+}
+
+// UpdatePasswordRequest is the body of PUT /users/password.
+type UpdatePasswordRequest struct {
+	Password        string `json:"password" validate:"required,password,bcrypt"`
+	PasswordConfirm string `json:"password_confirm" validate:"required,eqfield=Password"`
+}
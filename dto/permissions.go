@@ -0,0 +1,41 @@
+package dto
+
+import "github.com/lemadane/admin_backend_gofiber/models"
+
+// CreatePermissionRequest is the body of POST /permissions.
+// The name of the permission is derived from its resource, action and condition.
+type CreatePermissionRequest struct {
+	Resource    string `json:"resource" validate:"required,max=64"`
+	Action      string `json:"action" validate:"required,max=16"`
+	Condition   string `json:"condition" validate:"max=64"`
+	Description string `json:"description" validate:"max=255"`
+	Category    string `json:"category" validate:"max=64"`
+}
+
+// UpdatePermissionRequest is the body of PUT /permissions/:id.
+// What a permission grants cannot change; only how it is presented.
+type UpdatePermissionRequest struct {
+	Description string `json:"description" validate:"max=255"`
+	Category    string `json:"category" validate:"max=64"`
+}
+
+// PermissionMatrix is the grouped representation of all permissions, which the role editor
+// renders as a matrix with a row per resource and a column per action.
+type PermissionMatrix struct {
+	// Actions are the columns of the matrix, in order.
+	Actions []string          `json:"actions"`
+	Groups  []PermissionGroup `json:"groups"`
+}
+
+// PermissionGroup holds the rows of the matrix that belong to one category.
+type PermissionGroup struct {
+	Category  string          `json:"category"`
+	Resources []PermissionRow `json:"resources"`
+}
+
+// PermissionRow holds the permissions of one resource, keyed by action. A cell lists the
+// unconditional permission first, followed by the permissions restricted by a condition.
+type PermissionRow struct {
+	Resource string                         `json:"resource"`
+	Cells    map[string][]models.Permission `json:"cells"`
+}
@@ -0,0 +1,13 @@
+package dto
+
+// ProductRequest is the body of POST /products and PUT /products/:id.
+// An update replaces every field, so that the price and stock can be set to zero.
+type ProductRequest struct {
+	Title       string `json:"title" validate:"required,max=255"`
+	Description string `json:"description" validate:"max=5000"`
+	// Image is the URL of the product's image, e.g. as returned by POST /upload.
+	Image string  `json:"image" validate:"omitempty,url,max=255"`
+	Price float32 `json:"price" validate:"gte=0"`
+	Sku   string  `json:"sku" validate:"required,max=64"`
+	Stock uint    `json:"stock"`
+}
@@ -0,0 +1,23 @@
+package dto
+
+import "github.com/lemadane/admin_backend_gofiber/models"
+
+// RoleRequest is the body of POST /roles and PUT /roles/:id.
+type RoleRequest struct {
+	Name  string `json:"name" validate:"required,max=191"`
+	Level uint   `json:"level"`
+	// ParentId is the role to inherit permissions from; zero or omitted means none.
+	ParentId uint `json:"parent_id" validate:"exists=roles"`
+	// Permissions replaces the permissions of the role. It is required, so that omitting it cannot
+	// strip a role of its permissions by accident; an empty list removes them all. That the
+	// permissions exist is checked by the handlers, with one query for the whole list.
+	Permissions []uint `json:"permissions" validate:"required,max=1000,dive,required"`
+}
+
+// RoleUpdate is the response of PUT /roles/:id: the updated role together with the
+// permissions that the update assigned to it and removed from it.
+type RoleUpdate struct {
+	models.Role
+	Added   []models.Permission `json:"added"`
+	Removed []models.Permission `json:"removed"`
+}
@@ -0,0 +1,17 @@
+package dto
+
+import "github.com/lemadane/admin_backend_gofiber/search"
+
+// SearchResponse is the response of GET /search: the results grouped by type.
+type SearchResponse struct {
+	Query  string        `json:"query"`
+	Groups []SearchGroup `json:"groups"`
+}
+
+// SearchGroup holds the results of one type of entity, the best first.
+type SearchGroup struct {
+	Type string `json:"type"`
+	// Total is the number of matches, of which Results holds the first; it is at most search.MaxMatches.
+	Total   int             `json:"total"`
+	Results []search.Result `json:"results"`
+}
@@ -0,0 +1,103 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/lemadane/admin_backend_gofiber/models"
+)
+
+// CreateUserRequest is the body of POST /users.
+type CreateUserRequest struct {
+	Firstname string `json:"firstname" validate:"required,max=255"`
+	Lastname  string `json:"lastname" validate:"max=255"`
+	Email     string `json:"email" validate:"required,email,max=191,unique=users.email"`
+	PhoneNo   string `json:"phone_no" validate:"max=32"`
+	Region    string `json:"region" validate:"max=64"`
+	Password  string `json:"password" validate:"required,password,bcrypt"`
+	// RoleIds are the roles granted to the user. That they exist is checked by the handler, with one
+	// query for the whole list.
+	RoleIds []uint `json:"role_ids" validate:"max=100,dive,required"`
+}
+
+// UpdateUserRequest is the body of PUT /users/:id.
+// Omitted fields are left unchanged. Roles are granted and revoked through their own endpoints.
+type UpdateUserRequest struct {
+	Firstname string `json:"firstname" validate:"max=255"`
+	Lastname  string `json:"lastname" validate:"max=255"`
+	Email     string `json:"email" validate:"omitempty,email,max=191"`
+	PhoneNo   string `json:"phone_no" validate:"max=32"`
+	Region    string `json:"region" validate:"max=64"`
+}
+
+// GrantRoleRequest is the body of POST /users/:id/roles.
+type GrantRoleRequest struct {
+	RoleId uint `json:"role_id" validate:"required,exists=roles"`
+}
+
+// UserProfile is the public representation of a user, safe to show to any authenticated user,
+// e.g. to tell who made a change.
+type UserProfile struct {
+	Id        uint   `json:"id"`
+	Firstname string `json:"firstname"`
+	Lastname  string `json:"lastname"`
+}
+
+// UserSelf is the representation of the signed-in user, returned by the account endpoints.
+// It holds the fields that the user may edit themselves.
+type UserSelf struct {
+	Id        uint   `json:"id"`
+	Firstname string `json:"firstname"`
+	Lastname  string `json:"lastname"`
+	Email     string `json:"email"`
+	PhoneNo   string `json:"phone_no"`
+	Region    string `json:"region"`
+}
+
+// UserAdmin is the representation of a user returned by the user management endpoints.
+// Besides the fields of UserSelf, it holds the user's roles and when the user was created and last changed.
+type UserAdmin struct {
+	UserSelf
+	Roles     []models.Role `json:"roles"`
+	CreatedAt *time.Time    `json:"created_at"`
+	UpdatedAt *time.Time    `json:"updated_at"`
+}
+
+// NewUserProfile returns the public representation of user.
+func NewUserProfile(user models.User) UserProfile {
+	return UserProfile{
+		Id:        user.Id,
+		Firstname: user.Firstname,
+		Lastname:  user.Lastname,
+	}
+}
+
+// NewUserSelf returns the signed-in user's representation of user.
+func NewUserSelf(user models.User) UserSelf {
+	return UserSelf{
+		Id:        user.Id,
+		Firstname: user.Firstname,
+		Lastname:  user.Lastname,
+		Email:     user.Email,
+		PhoneNo:   user.PhoneNo,
+		Region:    user.Region,
+	}
+}
+
+// NewUserAdmin returns the user management representation of user.
+func NewUserAdmin(user models.User) UserAdmin {
+	return UserAdmin{
+		UserSelf:  NewUserSelf(user),
+		Roles:     user.Roles,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+	}
+}
+
+// NewUserAdminList returns the user management representation of every user.
+func NewUserAdminList(users []models.User) []UserAdmin {
+	list := make([]UserAdmin, len(users))
+	for i, user := range users {
+		list[i] = NewUserAdmin(user)
+	}
+	return list
+}
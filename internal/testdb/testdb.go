@@ -0,0 +1,37 @@
+// Package testdb gives each test a migrated database of its own.
+package testdb
+
+import (
+	"testing"
+
+	"github.com/lemadane/admin_backend_gofiber/authz"
+	"github.com/lemadane/admin_backend_gofiber/config"
+	"github.com/lemadane/admin_backend_gofiber/db"
+	"github.com/lemadane/admin_backend_gofiber/migrations"
+)
+
+// Setup sets the test configuration, connects to an in-memory SQLite database named after the test
+// and migrates it to the latest version. The database is held in SQLite's shared cache, so that every
+// connection of the pool sees the same database, and its name keeps it apart from the databases of
+// other tests. It is closed, which drops it, when the test ends. The cached permissions of the
+// previous database are dropped as well.
+// It returns the configuration, which the test may change before using it.
+func Setup(t *testing.T) *config.Config {
+	t.Helper()
+	cfg := config.Defaults(config.Test)
+	cfg.Database.DSN = "file:" + t.Name() + "?mode=memory&cache=shared"
+	config.Set(cfg)
+	if err := db.Connect(cfg.Database); err != nil {
+		t.Fatal(err)
+	}
+	sqlDb, err := db.Session().DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDb.Close() })
+	if _, err := migrations.Up(db.Session()); err != nil {
+		t.Fatal(err)
+	}
+	authz.InvalidateAll()
+	return cfg
+}
@@ -1,14 +1,149 @@
 package main
 
 import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/lemadane/admin_backend_gofiber/apierror"
+	"github.com/lemadane/admin_backend_gofiber/config"
 	"github.com/lemadane/admin_backend_gofiber/db"
+	"github.com/lemadane/admin_backend_gofiber/migrations"
+	"github.com/lemadane/admin_backend_gofiber/models"
 	"github.com/lemadane/admin_backend_gofiber/routes"
+	"github.com/lemadane/admin_backend_gofiber/search"
 )
 
+const usage = `usage: admin_backend_gofiber [command]
+
+commands:
+  serve                  start the HTTP server (default)
+  migrate up             apply all pending migrations
+  migrate down [steps]   revert the last migration, or the last [steps] migrations
+  migrate status         list migrations and whether they are applied
+  seed                   create the default permissions and admin role
+  grant <email> <role>   grant the named role to the user with the given email`
+
 func main() {
-	db.Connect()
-	app := fiber.New()
-	routes.Setup(app)
-	app.Listen(":5000")
-}
\ No newline at end of file
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := db.Connect(cfg.Database); err != nil {
+		log.Fatal(err)
+	}
+
+	args := os.Args[1:]
+	command := "serve"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "serve":
+		err = serve(cfg)
+	case "migrate":
+		err = migrate(args)
+	case "seed":
+		err = migrations.Seed(db.Session())
+	case "grant":
+		err = grant(args)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// serve starts the HTTP server, applying pending migrations first if configured to.
+func serve(cfg *config.Config) error {
+	if cfg.Database.AutoMigrate {
+		if _, err := migrations.Up(db.Session()); err != nil {
+			return err
+		}
+	}
+	if err := search.Watch(db.Session()); err != nil {
+		return err
+	}
+	app := fiber.New(fiber.Config{
+		ErrorHandler: apierror.Handler,
+	})
+	// A panicking handler fails its request with a 500 instead of stopping the server.
+	app.Use(recover.New())
+	if err := routes.Setup(app); err != nil {
+		return err
+	}
+	return app.Listen(cfg.Server.Addr)
+}
+
+// grant runs the grant subcommand, which is how the first administrator is appointed.
+func grant(args []string) error {
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var user models.User
+	if err := db.Session().Where("email = ?", args[0]).First(&user).Error; err != nil {
+		return fmt.Errorf("user %q: %w", args[0], err)
+	}
+	var role models.Role
+	if err := db.Session().Where("name = ?", args[1]).First(&role).Error; err != nil {
+		return fmt.Errorf("role %q: %w", args[1], err)
+	}
+	if err := db.Session().Model(&user).Association("Roles").Append(&role); err != nil {
+		return err
+	}
+	fmt.Printf("granted %s to %s\n", role.Name, user.Email)
+	return nil
+}
+
+// migrate runs the migrate subcommand.
+func migrate(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	switch args[0] {
+	case "up":
+		applied, err := migrations.Up(db.Session())
+		for _, migration := range applied {
+			fmt.Printf("applied  %04d %s\n", migration.Version, migration.Name)
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			parsed, err := strconv.Atoi(args[1])
+			if err != nil || parsed < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+			steps = parsed
+		}
+		reverted, err := migrations.Down(db.Session(), steps)
+		for _, migration := range reverted {
+			fmt.Printf("reverted %04d %s\n", migration.Version, migration.Name)
+		}
+		return err
+	case "status":
+		statuses, err := migrations.List(db.Session())
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d %-30s %s\n", status.Version, status.Name, appliedAt)
+		}
+		return nil
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+		return nil
+	}
+}
@@ -0,0 +1,30 @@
+package middlewares
+
+import (
+	"log"
+
+	"github.com/lemadane/admin_backend_gofiber/audit"
+	"github.com/lemadane/admin_backend_gofiber/db"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Audit returns a middleware that records a successful request in the audit log under action,
+// together with the target and the before and after states that the handler reported through
+// the audit package. Requests that fail or are rejected are not recorded.
+// The change is committed by the time the entry is written, so a failure to write it is
+// logged rather than turned into an error response.
+func Audit(action string) fiber.Handler {
+	return func(context *fiber.Ctx) error {
+		if err := context.Next(); err != nil {
+			return err
+		}
+		if context.Response().StatusCode() >= fiber.StatusBadRequest {
+			return nil
+		}
+		if err := audit.RecordRequest(db.Session(), context, action); err != nil {
+			log.Printf("audit: recording %s: %v", action, err)
+		}
+		return nil
+	}
+}
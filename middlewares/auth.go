@@ -1,22 +1,49 @@
 package middlewares
 
 import (
+	"github.com/lemadane/admin_backend_gofiber/apierror"
 	"github.com/lemadane/admin_backend_gofiber/utils"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 // IsAuthenticated is a middleware function that checks if the user is authenticated.
-// It retrieves the JWT token from the cookie and verifies its validity.
-// If the token is invalid or missing, it returns an unauthorized status and a JSON response.
-// Otherwise, it allows the request to proceed to the next middleware or route handler.
+// It retrieves the JWT token from the Authorization bearer header or the cookie and verifies its validity.
+// It also rejects tokens whose session has been revoked, for example by logging out. The state of
+// sessions is cached, so that most requests make no query; see utils.IsSessionActive.
+// If the token is invalid or missing, it returns a 401 API error.
+// Otherwise, it stores the claims of the token with utils.SetRequestClaims, so that UserId, SessionId,
+// the authorization and the audit log read them without parsing the token again, and allows the
+// request to proceed to the next middleware or route handler.
 func IsAuthenticated(context *fiber.Ctx) error {
-	cookie := context.Cookies("jwt")
-	if _, err := utils.ParseJwt(cookie); err != nil {
-		context.Status(fiber.StatusUnauthorized)
-		return context.JSON(fiber.Map{
-			"message": "Not authenticated",
-		})
+	claims, err := utils.ParseClaims(utils.TokenFromRequest(context))
+	if err != nil || !utils.IsSessionActive(claims.SessionId) {
+		return apierror.Unauthorized("Not authenticated")
 	}
+	if _, err := claims.UserId(); err != nil {
+		return apierror.Unauthorized("Not authenticated")
+	}
+	utils.SetRequestClaims(context, claims)
 	return context.Next()
 }
+
+// UserId returns the ID of the authenticated user, or zero for requests that did not pass
+// IsAuthenticated.
+func UserId(context *fiber.Ctx) uint {
+	claims := utils.RequestClaims(context)
+	if claims == nil {
+		return 0
+	}
+	id, _ := claims.UserId()
+	return id
+}
+
+// SessionId returns the session family of the authenticated request's token, or "" for requests that
+// did not pass IsAuthenticated.
+func SessionId(context *fiber.Ctx) string {
+	claims := utils.RequestClaims(context)
+	if claims == nil {
+		return ""
+	}
+	return claims.SessionId
+}
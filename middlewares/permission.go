@@ -1,59 +1,106 @@
 package middlewares
 
 import (
-	"errors"
-	"fmt"
-	"strconv"
+	"strings"
 
-	"github.com/lemadane/admin_backend_gofiber/db"
+	"github.com/lemadane/admin_backend_gofiber/apierror"
+	"github.com/lemadane/admin_backend_gofiber/authz"
 	"github.com/lemadane/admin_backend_gofiber/models"
 	"github.com/lemadane/admin_backend_gofiber/utils"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-// IsAuthorized checks if the user is authorized to access a specific page.
-// It takes a `context` object of type `*fiber.Ctx` and a `page` string as parameters.
-// It returns an error if the user is unauthorized, otherwise it returns nil.
-// The function first checks if the user has a valid JWT token in the cookie.
-// If the token is valid, it retrieves the user ID from the token and fetches the user from the database.
-// Then it retrieves the user's role and its associated permissions from the database.
-// If the HTTP method is GET, it checks if the user has either "view"+page or "edit"+page permission.
-// If the HTTP method is not GET, it only checks if the user has "edit"+page permission.
-// If the user has the required permission, it returns nil indicating authorization.
-// If the user is unauthorized, it sets the response status to 401 (Unauthorized) and returns an error.
-func IsAuthorized(context *fiber.Ctx, page string) error {
-	cookie := context.Cookies("jwt")
-	id, err := utils.ParseJwt(cookie)
+// ActionByMethod derives the action from the request: GET on a route with an :id
+// parameter reads, any other GET lists, POST creates, PUT and PATCH update and DELETE deletes.
+const ActionByMethod authz.Action = ""
+
+// decisionKey is the key of the request local that holds the authorization decision.
+const decisionKey = "authz.decision"
+
+// Authorize checks if the user may perform the action on a resource.
+// The function reads the claims of the token verified by IsAuthenticated.
+// It resolves the permissions of the user's role through the authz cache,
+// which only queries the database when the role embedded in the token can no longer be trusted.
+// The action is allowed by a "resource:action" permission or by a wildcard grant such as "resource:*".
+// If the user has the required permission, it stores the decision for Scope and returns nil indicating authorization.
+// If the request was not authenticated it returns a 401 API error, and if the permission is missing a 403 API error.
+func Authorize(context *fiber.Ctx, resource string, action authz.Action) error {
+	subject, err := subjectFromRequest(context)
 	if err != nil {
-		context.Status(fiber.StatusUnauthorized)
-		return context.JSON(fiber.Map{
-			"message": "Not authorized",
-		})
-	}
-	userId, _ := strconv.Atoi(*id)
-	user := models.User{
-		Id: uint(userId),
-	}
-	db.Session().Preload("Role").Find(&user)
-	role := models.Role{
-		Id: user.RoleId,
-	}
-	db.Session().Preload("Permissions").Find(&role)
-	fmt.Println(role.Permissions)
-	if context.Method() == "GET" {
-		for _, permission := range role.Permissions {
-			if permission.Name == "view"+page || permission.Name == "edit"+page {
-				return nil
-			}
-		}
-	} else {
-		for _, permission := range role.Permissions {
-			if permission.Name == "edit"+page {
-				return nil
-			}
+		return err
+	}
+	if action == ActionByMethod {
+		action = actionFromRequest(context)
+	}
+	decision, allowed, err := authz.Decide(subject, resource, action)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return apierror.Forbidden("Not authorized")
+	}
+	context.Locals(decisionKey, decision)
+	return nil
+}
+
+// Permitted reports whether the user may perform the action on a resource and returns the scope of the
+// rows they may access, without failing the request when they may not. Handlers that span several
+// resources, such as search, use it to leave out the resources the user has no permission for.
+// It returns a 401 API error if the request was not authenticated.
+func Permitted(context *fiber.Ctx, resource string, action authz.Action) (models.Scope, bool, error) {
+	subject, err := subjectFromRequest(context)
+	if err != nil {
+		return nil, false, err
+	}
+	decision, allowed, err := authz.Decide(subject, resource, action)
+	if err != nil || !allowed {
+		return nil, false, err
+	}
+	return decision.Scope(), true, nil
+}
+
+// subjectFromRequest returns the authorization subject of the user whose token IsAuthenticated verified.
+// It returns a 401 API error if the request was not authenticated.
+func subjectFromRequest(context *fiber.Ctx) (authz.Subject, error) {
+	claims := utils.RequestClaims(context)
+	if claims == nil {
+		return authz.Subject{}, apierror.Unauthorized("Not authenticated")
+	}
+	return authz.Subject{
+		UserId:             UserId(context),
+		RoleIds:            claims.RoleIds,
+		PermissionsVersion: claims.PermissionsVersion,
+	}, nil
+}
+
+// Scope returns the scope that restricts queries to the rows of the authorized resource that the
+// user may access, as decided by the row-level conditions of the user's permissions.
+// Handlers apply it to every query on the resource, so that rows outside of it are neither
+// listed nor counted and behave as missing. Requests that were not authorized against a
+// resource, such as those of AnyAuthenticated routes, are not restricted.
+func Scope(context *fiber.Ctx) models.Scope {
+	decision, ok := context.Locals(decisionKey).(authz.Decision)
+	if !ok {
+		return models.Unrestricted
+	}
+	return decision.Scope()
+}
+
+// actionFromRequest derives the action of a request from its method and route.
+func actionFromRequest(context *fiber.Ctx) authz.Action {
+	switch context.Method() {
+	case fiber.MethodGet, fiber.MethodHead:
+		if strings.Contains(context.Route().Path, ":id") {
+			return authz.ActionRead
 		}
+		return authz.ActionList
+	case fiber.MethodPost:
+		return authz.ActionCreate
+	case fiber.MethodPut, fiber.MethodPatch:
+		return authz.ActionUpdate
+	case fiber.MethodDelete:
+		return authz.ActionDelete
 	}
-	context.Status(fiber.StatusUnauthorized)
-	return errors.New("Not authorized")
+	return authz.ActionUpdate
 }
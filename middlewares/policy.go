@@ -0,0 +1,64 @@
+package middlewares
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/lemadane/admin_backend_gofiber/authz"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Policy declares what an authenticated route requires.
+// Policies are built with Permission or AnyAuthenticated; the zero Policy is
+// invalid, so a route can never be left unprotected by omission.
+type Policy struct {
+	Resource string
+	Action   authz.Action
+	// authenticatedOnly marks routes that any authenticated user may call.
+	authenticatedOnly bool
+}
+
+// AnyAuthenticated is the policy of routes that need no permission beyond being signed in,
+// such as a user editing their own account.
+var AnyAuthenticated = Policy{authenticatedOnly: true}
+
+// Permission returns the policy that requires the action on resource.
+// Without an action, it is derived from the request.
+func Permission(resource string, action ...authz.Action) Policy {
+	policy := Policy{Resource: resource}
+	if len(action) > 0 {
+		policy.Action = action[0]
+	}
+	return policy
+}
+
+// Validate reports whether the policy is complete, and whether the action it requires is one that
+// authz.ResourceActions lists for the resource, so that the seeded permissions can grant it.
+func (policy Policy) Validate() error {
+	if policy.authenticatedOnly {
+		return nil
+	}
+	if policy.Resource == "" {
+		return errors.New("policy has no resource")
+	}
+	if policy.Action != ActionByMethod && !authz.IsAction(string(policy.Action)) {
+		return errors.New("policy has unknown action " + string(policy.Action))
+	}
+	if policy.Action != ActionByMethod && !slices.Contains(authz.ResourceActions[policy.Resource], policy.Action) {
+		return errors.New("policy requires " + authz.Name(policy.Resource, policy.Action) + ", which authz.ResourceActions does not list")
+	}
+	return nil
+}
+
+// Enforce returns a middleware that lets the request through only if it satisfies the policy.
+func Enforce(policy Policy) fiber.Handler {
+	return func(context *fiber.Ctx) error {
+		if !policy.authenticatedOnly {
+			if err := Authorize(context, policy.Resource, policy.Action); err != nil {
+				return err
+			}
+		}
+		return context.Next()
+	}
+}
@@ -0,0 +1,102 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// The types below are snapshots of the schema at version 1. They are kept separate
+// from the models package so that later model changes do not rewrite this migration.
+
+type permission0001 struct {
+	Id   uint
+	Name string `gorm:"size:191;uniqueIndex"`
+}
+
+func (permission0001) TableName() string { return "permissions" }
+
+type role0001 struct {
+	Id   uint
+	Name string `gorm:"size:191;uniqueIndex"`
+}
+
+func (role0001) TableName() string { return "roles" }
+
+type rolePermission0001 struct {
+	RoleId       uint `gorm:"primaryKey"`
+	PermissionId uint `gorm:"primaryKey"`
+}
+
+func (rolePermission0001) TableName() string { return "role_permissions" }
+
+type user0001 struct {
+	Id        uint
+	Firstname string
+	Lastname  string
+	Email     string `gorm:"size:191;uniqueIndex"`
+	PhoneNo   string
+	Password  string
+	RoleId    uint `gorm:"index"`
+}
+
+func (user0001) TableName() string { return "users" }
+
+type order0001 struct {
+	Id        uint
+	Firstname string
+	Lastname  string
+	Email     string `gorm:"size:191;index"`
+	UpdatedAt time.Time
+	CreatedAt time.Time
+}
+
+func (order0001) TableName() string { return "orders" }
+
+type orderItem0001 struct {
+	Id           uint
+	OrderId      uint `gorm:"index"`
+	ProductTitle string
+	Price        float32
+	Quantity     uint
+}
+
+func (orderItem0001) TableName() string { return "order_items" }
+
+func init() {
+	register(Migration{
+		Version: 1,
+		Name:    "create_initial_schema",
+		Up: func(tx *gorm.DB) error {
+			// Databases that predate migrations already have some of these tables;
+			// they are adopted as they are rather than recreated.
+			tables := []interface{}{
+				&permission0001{},
+				&role0001{},
+				&rolePermission0001{},
+				&user0001{},
+				&order0001{},
+				&orderItem0001{},
+			}
+			for _, table := range tables {
+				if tx.Migrator().HasTable(table) {
+					continue
+				}
+				if err := tx.Migrator().CreateTable(table); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(
+				&orderItem0001{},
+				&order0001{},
+				&user0001{},
+				&rolePermission0001{},
+				&role0001{},
+				&permission0001{},
+			)
+		},
+	})
+}
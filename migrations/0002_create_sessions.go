@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type session0002 struct {
+	Id           uint
+	FamilyId     string `gorm:"size:36;index"`
+	UserId       uint   `gorm:"index"`
+	TokenHash    string `gorm:"size:64;uniqueIndex"`
+	UserAgent    string
+	Ip           string `gorm:"size:45"`
+	ExpiresAt    time.Time
+	RevokedAt    *time.Time
+	ReplacedById *uint
+	CreatedAt    time.Time
+}
+
+func (session0002) TableName() string { return "sessions" }
+
+func init() {
+	register(Migration{
+		Version: 2,
+		Name:    "create_sessions",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&session0002{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&session0002{})
+		},
+	})
+}
@@ -0,0 +1,23 @@
+package migrations
+
+import "gorm.io/gorm"
+
+type role0003 struct {
+	Id                 uint
+	PermissionsVersion uint `gorm:"not null;default:1"`
+}
+
+func (role0003) TableName() string { return "roles" }
+
+func init() {
+	register(Migration{
+		Version: 3,
+		Name:    "add_roles_permissions_version",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&role0003{}, "PermissionsVersion")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&role0003{}, "PermissionsVersion")
+		},
+	})
+}
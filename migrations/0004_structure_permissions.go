@@ -0,0 +1,130 @@
+package migrations
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type permission0004 struct {
+	Id       uint
+	Name     string `gorm:"size:191;uniqueIndex"`
+	Resource string `gorm:"size:64;not null;default:''"`
+	Action   string `gorm:"size:16;not null;default:''"`
+}
+
+func (permission0004) TableName() string { return "permissions" }
+
+// Version 4 splits permissions into resource and action columns.
+// Legacy "view<resource>" rows become "<resource>:read" and every role holding one also
+// receives "<resource>:list"; legacy "edit<resource>" rows, which used to allow everything
+// on the resource, become the wildcard "<resource>:*".
+func init() {
+	register(Migration{
+		Version: 4,
+		Name:    "structure_permissions",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumnsIfMissing(tx, &permission0004{}, "Resource", "Action"); err != nil {
+				return err
+			}
+			var permissions []permission0004
+			if err := tx.Find(&permissions).Error; err != nil {
+				return err
+			}
+			for _, permission := range permissions {
+				var err error
+				switch {
+				case strings.HasPrefix(permission.Name, "view") && len(permission.Name) > len("view"):
+					err = upgradeViewPermission0004(tx, permission)
+				case strings.HasPrefix(permission.Name, "edit") && len(permission.Name) > len("edit"):
+					resource := strings.TrimPrefix(permission.Name, "edit")
+					err = setPermission0004(tx, permission.Id, resource, "*")
+				default:
+					if resource, action, found := strings.Cut(permission.Name, ":"); found {
+						err = setPermission0004(tx, permission.Id, resource, action)
+					}
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return bumpPermissionsVersions0004(tx)
+		},
+		Down: func(tx *gorm.DB) error {
+			// The names were restored before the resource column was dropped.
+			if !tx.Migrator().HasColumn(&permission0004{}, "Resource") {
+				return dropColumnsIfExist(tx, &permission0004{}, "Action")
+			}
+			var permissions []permission0004
+			if err := tx.Find(&permissions).Error; err != nil {
+				return err
+			}
+			for _, permission := range permissions {
+				var err error
+				switch permission.Action {
+				case "read":
+					err = tx.Model(&permission0004{}).Where("id = ?", permission.Id).
+						Update("name", "view"+permission.Resource).Error
+				case "*":
+					err = tx.Model(&permission0004{}).Where("id = ?", permission.Id).
+						Update("name", "edit"+permission.Resource).Error
+				case "":
+				default:
+					// Finer-grained permissions have no legacy equivalent and are removed.
+					err = deletePermission0004(tx, permission.Id)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			if err := bumpPermissionsVersions0004(tx); err != nil {
+				return err
+			}
+			return dropColumnsIfExist(tx, &permission0004{}, "Resource", "Action")
+		},
+	})
+}
+
+// upgradeViewPermission0004 turns a legacy view permission into "<resource>:read"
+// and grants "<resource>:list" to every role that held it.
+func upgradeViewPermission0004(tx *gorm.DB, permission permission0004) error {
+	resource := strings.TrimPrefix(permission.Name, "view")
+	if err := setPermission0004(tx, permission.Id, resource, "read"); err != nil {
+		return err
+	}
+	list := permission0004{Name: resource + ":list"}
+	err := tx.Where("name = ?", list.Name).
+		Attrs(permission0004{Resource: resource, Action: "list"}).
+		FirstOrCreate(&list).Error
+	if err != nil {
+		return err
+	}
+	return tx.Exec(`
+		INSERT INTO role_permissions (role_id, permission_id)
+		SELECT rp.role_id, ? FROM role_permissions rp
+		WHERE rp.permission_id = ? AND NOT EXISTS (
+			SELECT 1 FROM role_permissions x WHERE x.role_id = rp.role_id AND x.permission_id = ?
+		)`, list.Id, permission.Id, list.Id).Error
+}
+
+// setPermission0004 stores the resource, action and canonical name of a permission.
+func setPermission0004(tx *gorm.DB, id uint, resource string, action string) error {
+	return tx.Model(&permission0004{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"name":     resource + ":" + action,
+		"resource": resource,
+		"action":   action,
+	}).Error
+}
+
+// bumpPermissionsVersions0004 makes every issued token reload its permissions, since their names changed.
+func bumpPermissionsVersions0004(tx *gorm.DB) error {
+	return tx.Exec("UPDATE roles SET permissions_version = permissions_version + 1").Error
+}
+
+// deletePermission0004 deletes a permission together with its role assignments.
+func deletePermission0004(tx *gorm.DB, id uint) error {
+	if err := tx.Exec("DELETE FROM role_permissions WHERE permission_id = ?", id).Error; err != nil {
+		return err
+	}
+	return tx.Delete(&permission0004{}, id).Error
+}
@@ -0,0 +1,93 @@
+package migrations
+
+import "gorm.io/gorm"
+
+type user0005 struct {
+	Id     uint
+	Region string `gorm:"size:64;not null;default:'';index"`
+}
+
+func (user0005) TableName() string { return "users" }
+
+type order0005 struct {
+	Id     uint
+	Region string `gorm:"size:64;not null;default:'';index"`
+}
+
+func (order0005) TableName() string { return "orders" }
+
+type role0005 struct {
+	Id    uint
+	Level uint `gorm:"not null;default:0"`
+}
+
+func (role0005) TableName() string { return "roles" }
+
+type permission0005 struct {
+	Id        uint
+	Condition string `gorm:"column:condition_name;size:64;not null;default:''"`
+}
+
+func (permission0005) TableName() string { return "permissions" }
+
+// Version 5 adds the attributes that row-level conditions compare: the region of users and
+// orders, the level of roles, and the condition that restricts a permission.
+func init() {
+	register(Migration{
+		Version: 5,
+		Name:    "add_row_level_attributes",
+		Up: func(tx *gorm.DB) error {
+			columns := []struct {
+				model interface{}
+				field string
+			}{
+				{&user0005{}, "Region"},
+				{&order0005{}, "Region"},
+				{&role0005{}, "Level"},
+				{&permission0005{}, "Condition"},
+			}
+			for _, column := range columns {
+				if err := addColumnsIfMissing(tx, column.model, column.field); err != nil {
+					return err
+				}
+			}
+			if err := createIndexIfMissing(tx, &user0005{}, "Region"); err != nil {
+				return err
+			}
+			return createIndexIfMissing(tx, &order0005{}, "Region")
+		},
+		Down: func(tx *gorm.DB) error {
+			// Without their condition, conditional permissions would grant access to every row.
+			err := tx.Exec(`
+				DELETE FROM role_permissions WHERE permission_id IN (
+					SELECT id FROM permissions WHERE condition_name <> ''
+				)`).Error
+			if err != nil {
+				return err
+			}
+			if err := tx.Where("condition_name <> ''").Delete(&permission0005{}).Error; err != nil {
+				return err
+			}
+			for _, model := range []interface{}{&user0005{}, &order0005{}} {
+				if err := dropIndexIfExists(tx, model, "Region"); err != nil {
+					return err
+				}
+			}
+			columns := []struct {
+				model interface{}
+				field string
+			}{
+				{&user0005{}, "Region"},
+				{&order0005{}, "Region"},
+				{&role0005{}, "Level"},
+				{&permission0005{}, "Condition"},
+			}
+			for _, column := range columns {
+				if err := dropColumnsIfExist(tx, column.model, column.field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
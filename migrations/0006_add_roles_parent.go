@@ -0,0 +1,30 @@
+package migrations
+
+import "gorm.io/gorm"
+
+type role0006 struct {
+	Id       uint
+	ParentId *uint `gorm:"index"`
+}
+
+func (role0006) TableName() string { return "roles" }
+
+// Version 6 lets a role inherit the permissions of a parent role.
+func init() {
+	register(Migration{
+		Version: 6,
+		Name:    "add_roles_parent",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().AddColumn(&role0006{}, "ParentId"); err != nil {
+				return err
+			}
+			return tx.Migrator().CreateIndex(&role0006{}, "ParentId")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := dropIndexIfExists(tx, &role0006{}, "ParentId"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&role0006{}, "ParentId")
+		},
+	})
+}
@@ -0,0 +1,68 @@
+package migrations
+
+import "gorm.io/gorm"
+
+type userRole0007 struct {
+	UserId uint `gorm:"primaryKey"`
+	RoleId uint `gorm:"primaryKey;index"`
+}
+
+func (userRole0007) TableName() string { return "user_roles" }
+
+type user0007 struct {
+	Id     uint
+	RoleId uint `gorm:"index"`
+}
+
+func (user0007) TableName() string { return "users" }
+
+// Version 7 lets a user hold several roles. The single users.role_id column is replaced by the
+// user_roles join table, and every user keeps the role they had. References to roles that no
+// longer exist are dropped.
+func init() {
+	register(Migration{
+		Version: 7,
+		Name:    "create_user_roles",
+		Up: func(tx *gorm.DB) error {
+			if err := createTableIfMissing(tx, &userRole0007{}); err != nil {
+				return err
+			}
+			// The roles were copied before the column was dropped.
+			if !tx.Migrator().HasColumn(&user0007{}, "RoleId") {
+				return nil
+			}
+			err := tx.Exec(`
+				INSERT INTO user_roles (user_id, role_id)
+				SELECT users.id, users.role_id FROM users
+				JOIN roles ON roles.id = users.role_id
+				WHERE NOT EXISTS (
+					SELECT 1 FROM user_roles x WHERE x.user_id = users.id AND x.role_id = users.role_id
+				)`).Error
+			if err != nil {
+				return err
+			}
+			if err := dropIndexIfExists(tx, &user0007{}, "RoleId"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&user0007{}, "RoleId")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := addColumnsIfMissing(tx, &user0007{}, "RoleId"); err != nil {
+				return err
+			}
+			if err := createIndexIfMissing(tx, &user0007{}, "RoleId"); err != nil {
+				return err
+			}
+			// A single role has to be chosen; the lowest ID is kept.
+			err := tx.Exec(`
+				UPDATE users SET role_id = (
+					SELECT MIN(user_roles.role_id) FROM user_roles WHERE user_roles.user_id = users.id
+				)
+				WHERE EXISTS (SELECT 1 FROM user_roles WHERE user_roles.user_id = users.id)`).Error
+			if err != nil {
+				return err
+			}
+			return tx.Migrator().DropTable(&userRole0007{})
+		},
+	})
+}
@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type auditLog0008 struct {
+	Id         uint
+	ActorId    uint   `gorm:"index"`
+	Action     string `gorm:"size:64;index"`
+	TargetType string `gorm:"size:64;index:idx_audit_logs_target"`
+	TargetId   uint   `gorm:"index:idx_audit_logs_target"`
+	Before     string `gorm:"type:text"`
+	After      string `gorm:"type:text"`
+	Ip         string `gorm:"size:45"`
+	UserAgent  string
+	CreatedAt  time.Time `gorm:"index"`
+}
+
+func (auditLog0008) TableName() string { return "audit_logs" }
+
+func init() {
+	register(Migration{
+		Version: 8,
+		Name:    "create_audit_logs",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&auditLog0008{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&auditLog0008{})
+		},
+	})
+}
@@ -0,0 +1,33 @@
+package migrations
+
+import "gorm.io/gorm"
+
+type permission0009 struct {
+	Id          uint
+	Description string `gorm:"size:255;not null;default:''"`
+	Category    string `gorm:"size:64;not null;default:'';index"`
+	System      bool   `gorm:"column:is_system;not null;default:false"`
+}
+
+func (permission0009) TableName() string { return "permissions" }
+
+// Version 9 adds the description and category shown in the role editor, and marks the
+// permissions that the system defines. Existing permissions are completed by the seed command.
+func init() {
+	register(Migration{
+		Version: 9,
+		Name:    "describe_permissions",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumnsIfMissing(tx, &permission0009{}, "Description", "Category", "System"); err != nil {
+				return err
+			}
+			return createIndexIfMissing(tx, &permission0009{}, "Category")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := dropIndexIfExists(tx, &permission0009{}, "Category"); err != nil {
+				return err
+			}
+			return dropColumnsIfExist(tx, &permission0009{}, "Description", "Category", "System")
+		},
+	})
+}
@@ -0,0 +1,25 @@
+package migrations
+
+import "gorm.io/gorm"
+
+type role0010 struct {
+	Id     uint
+	System bool `gorm:"column:is_system;not null;default:false"`
+}
+
+func (role0010) TableName() string { return "roles" }
+
+// Version 10 marks the roles that the system defines, which cannot be deleted.
+// Existing roles are marked by the seed command.
+func init() {
+	register(Migration{
+		Version: 10,
+		Name:    "mark_system_roles",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&role0010{}, "System")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&role0010{}, "System")
+		},
+	})
+}
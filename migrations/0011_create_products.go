@@ -0,0 +1,55 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type product0011 struct {
+	Id          uint
+	Title       string `gorm:"size:255;not null"`
+	Description string `gorm:"type:text"`
+	Image       string `gorm:"size:255"`
+	Price       float32
+	Sku         string `gorm:"size:64;uniqueIndex"`
+	Stock       uint
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (product0011) TableName() string { return "products" }
+
+type orderItem0011 struct {
+	Id        uint
+	ProductId *uint `gorm:"index"`
+}
+
+func (orderItem0011) TableName() string { return "order_items" }
+
+// Version 11 creates the product catalog and lets order items refer to the product they were ordered from.
+// Existing order items keep their free-text title and price, and refer to no product.
+func init() {
+	register(Migration{
+		Version: 11,
+		Name:    "create_products",
+		Up: func(tx *gorm.DB) error {
+			if err := createTableIfMissing(tx, &product0011{}); err != nil {
+				return err
+			}
+			if err := addColumnsIfMissing(tx, &orderItem0011{}, "ProductId"); err != nil {
+				return err
+			}
+			return createIndexIfMissing(tx, &orderItem0011{}, "ProductId")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := dropIndexIfExists(tx, &orderItem0011{}, "ProductId"); err != nil {
+				return err
+			}
+			if err := dropColumnsIfExist(tx, &orderItem0011{}, "ProductId"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropTable(&product0011{})
+		},
+	})
+}
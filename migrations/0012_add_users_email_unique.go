@@ -0,0 +1,44 @@
+package migrations
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type user0012 struct {
+	Id    uint
+	Email string `gorm:"size:191;uniqueIndex"`
+}
+
+func (user0012) TableName() string { return "users" }
+
+// Version 12 makes sure that no two users share an email address. Version 1 declares the unique index,
+// but tables adopted from before migrations may lack it, and SQLite loses it when version 7 drops a
+// column of users. The migration fails, naming the addresses, if some are already shared; those users
+// have to be merged or changed by hand first.
+func init() {
+	register(Migration{
+		Version: 12,
+		Name:    "add_users_email_unique",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasIndex(&user0012{}, "Email") {
+				return nil
+			}
+			var shared []string
+			err := tx.Model(&user0012{}).Group("email").Having("COUNT(*) > 1").Pluck("email", &shared).Error
+			if err != nil {
+				return err
+			}
+			if len(shared) > 0 {
+				return fmt.Errorf("several users share the email addresses %s", strings.Join(shared, ", "))
+			}
+			return tx.Migrator().CreateIndex(&user0012{}, "Email")
+		},
+		Down: func(tx *gorm.DB) error {
+			// The index belongs to the schema of version 1, so it is kept.
+			return nil
+		},
+	})
+}
@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type user0013 struct {
+	Id        uint
+	CreatedAt *time.Time
+	UpdatedAt *time.Time
+}
+
+func (user0013) TableName() string { return "users" }
+
+// Version 13 records when users are created and last changed. They are unknown, and left empty, for
+// existing users.
+func init() {
+	register(Migration{
+		Version: 13,
+		Name:    "add_users_timestamps",
+		Up: func(tx *gorm.DB) error {
+			return addColumnsIfMissing(tx, &user0013{}, "CreatedAt", "UpdatedAt")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumnsIfExist(tx, &user0013{}, "UpdatedAt", "CreatedAt")
+		},
+	})
+}
@@ -0,0 +1,67 @@
+package migrations
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// searchColumns0014 are the columns that the database search backend matches, by table.
+var searchColumns0014 = []struct {
+	table   string
+	columns []string
+}{
+	{"users", []string{"email", "firstname", "lastname", "phone_no"}},
+	{"orders", []string{"email", "firstname", "lastname"}},
+	{"order_items", []string{"product_title"}},
+}
+
+// Version 14 adds the full-text indexes that the database search backend queries: a FULLTEXT index per
+// column on MySQL and, on PostgreSQL, a GIN index per column on the expression that the backend
+// matches, which splits values into words at any character other than a letter or digit. SQLite has no
+// full-text index that works on existing tables, so the backend uses LIKE there and nothing is added.
+func init() {
+	register(Migration{
+		Version: 14,
+		Name:    "add_search_indexes",
+		Up: func(tx *gorm.DB) error {
+			migrator := tx.Migrator()
+			for _, search := range searchColumns0014 {
+				for _, column := range search.columns {
+					name := fmt.Sprintf("idx_%s_%s_search", search.table, column)
+					if migrator.HasIndex(search.table, name) {
+						continue
+					}
+					var sql string
+					switch tx.Dialector.Name() {
+					case "mysql":
+						sql = fmt.Sprintf("CREATE FULLTEXT INDEX %s ON %s (%s)", name, search.table, column)
+					case "postgres":
+						sql = fmt.Sprintf(`CREATE INDEX %s ON %s USING GIN (to_tsvector('simple', regexp_replace(%s, '[^[:alnum:]]+', ' ', 'g')))`, name, search.table, column)
+					default:
+						return nil
+					}
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			migrator := tx.Migrator()
+			for _, search := range searchColumns0014 {
+				for _, column := range search.columns {
+					name := fmt.Sprintf("idx_%s_%s_search", search.table, column)
+					if !migrator.HasIndex(search.table, name) {
+						continue
+					}
+					if err := migrator.DropIndex(search.table, name); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,215 @@
+package migrations
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration is a single, versioned schema change.
+// Up applies the change and Down reverts it. Both run inside a transaction
+// together with the bookkeeping in the schema_migrations table. On PostgreSQL and SQLite a
+// migration that fails therefore leaves no trace. MySQL commits every schema change at once,
+// even inside a transaction, so there a failed migration keeps the schema changes it made
+// before failing, and those made after a schema change. Migrations that make several changes
+// skip the schema changes that were already made, through the helpers below, so that they
+// can be run again once the cause of the failure is fixed.
+type Migration struct {
+	Version uint
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration records a migration that has been applied to the database.
+type SchemaMigration struct {
+	Version   uint      `json:"version" gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `json:"name"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// Status describes whether a known migration has been applied.
+type Status struct {
+	Version   uint       `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// registry holds every known migration, keyed by version.
+var registry = map[uint]Migration{}
+
+// register adds a migration to the registry. It is called from the init function
+// of each migration file and panics on duplicate versions.
+func register(migration Migration) {
+	if _, exists := registry[migration.Version]; exists {
+		panic(fmt.Sprintf("migrations: duplicate version %d", migration.Version))
+	}
+	registry[migration.Version] = migration
+}
+
+// All returns every known migration ordered by version.
+func All() []Migration {
+	all := make([]Migration, 0, len(registry))
+	for _, migration := range registry {
+		all = append(all, migration)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Version < all[j].Version
+	})
+	return all
+}
+
+// Up applies every pending migration in version order.
+// It returns the migrations that were applied.
+func Up(db *gorm.DB) ([]Migration, error) {
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+	ran := make([]Migration, 0)
+	for _, migration := range All() {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return ran, fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+		ran = append(ran, migration)
+	}
+	return ran, nil
+}
+
+// Down reverts the given number of most recently applied migrations.
+// It returns the migrations that were reverted.
+func Down(db *gorm.DB, steps int) ([]Migration, error) {
+	if err := ensureTable(db); err != nil {
+		return nil, err
+	}
+	var records []SchemaMigration
+	if err := db.Order("version desc").Limit(steps).Find(&records).Error; err != nil {
+		return nil, err
+	}
+	reverted := make([]Migration, 0, len(records))
+	for _, record := range records {
+		migration, ok := registry[record.Version]
+		if !ok {
+			return reverted, fmt.Errorf("migration %d is applied but unknown to this build", record.Version)
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, record.Version).Error
+		})
+		if err != nil {
+			return reverted, fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+		reverted = append(reverted, migration)
+	}
+	return reverted, nil
+}
+
+// List returns the status of every known migration in version order.
+func List(db *gorm.DB) ([]Status, error) {
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, 0, len(registry))
+	for _, migration := range All() {
+		status := Status{
+			Version: migration.Version,
+			Name:    migration.Name,
+		}
+		if record, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &record.AppliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// appliedVersions returns the applied migrations keyed by version.
+func appliedVersions(db *gorm.DB) (map[uint]SchemaMigration, error) {
+	if err := ensureTable(db); err != nil {
+		return nil, err
+	}
+	var records []SchemaMigration
+	if err := db.Find(&records).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[uint]SchemaMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// ensureTable creates the schema_migrations tracking table if it does not exist.
+func ensureTable(db *gorm.DB) error {
+	return db.AutoMigrate(&SchemaMigration{})
+}
+
+// createTableIfMissing creates the table of model, unless it exists.
+func createTableIfMissing(tx *gorm.DB, model interface{}) error {
+	if tx.Migrator().HasTable(model) {
+		return nil
+	}
+	return tx.Migrator().CreateTable(model)
+}
+
+// addColumnsIfMissing adds the columns of the given fields of model that do not exist yet.
+func addColumnsIfMissing(tx *gorm.DB, model interface{}, fields ...string) error {
+	for _, field := range fields {
+		if tx.Migrator().HasColumn(model, field) {
+			continue
+		}
+		if err := tx.Migrator().AddColumn(model, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropColumnsIfExist drops the columns of the given fields of model that exist.
+func dropColumnsIfExist(tx *gorm.DB, model interface{}, fields ...string) error {
+	for _, field := range fields {
+		if !tx.Migrator().HasColumn(model, field) {
+			continue
+		}
+		if err := tx.Migrator().DropColumn(model, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createIndexIfMissing creates the index of a field of model, unless it exists.
+func createIndexIfMissing(tx *gorm.DB, model interface{}, field string) error {
+	if tx.Migrator().HasIndex(model, field) {
+		return nil
+	}
+	return tx.Migrator().CreateIndex(model, field)
+}
+
+// dropIndexIfExists drops the index of a field of model, unless it does not exist. SQLite rebuilds a
+// table to drop one of its columns, which loses the indexes of the table, so an index that a migration
+// created may be gone by the time the migration is reverted.
+func dropIndexIfExists(tx *gorm.DB, model interface{}, field string) error {
+	if !tx.Migrator().HasIndex(model, field) {
+		return nil
+	}
+	return tx.Migrator().DropIndex(model, field)
+}
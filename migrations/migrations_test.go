@@ -0,0 +1,106 @@
+package migrations_test
+
+import (
+	"testing"
+
+	"github.com/lemadane/admin_backend_gofiber/db"
+	"github.com/lemadane/admin_backend_gofiber/internal/testdb"
+	"github.com/lemadane/admin_backend_gofiber/migrations"
+	"github.com/lemadane/admin_backend_gofiber/models"
+)
+
+func TestDownAndUpAgain(t *testing.T) {
+	testdb.Setup(t)
+	if err := migrations.Seed(db.Session()); err != nil {
+		t.Fatal(err)
+	}
+	all := migrations.All()
+	reverted, err := migrations.Down(db.Session(), len(all))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != len(all) {
+		t.Fatalf("Down() reverted %d migrations, want %d", len(reverted), len(all))
+	}
+	ran, err := migrations.Up(db.Session())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != len(all) {
+		t.Fatalf("Up() ran %d migrations, want %d", len(ran), len(all))
+	}
+}
+
+func TestRunAgain(t *testing.T) {
+	// These migrations make several schema changes, so on MySQL a failure may leave some of them
+	// made. Running them again on the complete schema covers the case where all of them were made.
+	versions := []uint{4, 5, 7, 9, 11, 13, 14}
+	testdb.Setup(t)
+	if err := migrations.Seed(db.Session()); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Session().Where("version IN ?", versions).Delete(&migrations.SchemaMigration{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	ran, err := migrations.Up(db.Session())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != len(versions) {
+		t.Errorf("Up() ran %d migrations, want %d", len(ran), len(versions))
+	}
+}
+
+func TestSeed(t *testing.T) {
+	testdb.Setup(t)
+	// Permissions that an earlier seed created for actions no route checks: one held by a role,
+	// one not, and a permission created by a user for the same kind of action.
+	stale := []models.Permission{
+		{Name: "orders:read", Resource: "orders", Action: "read", System: true},
+		{Name: "orders:approve", Resource: "orders", Action: "approve", System: true},
+		{Name: "orders:delete", Resource: "orders", Action: "delete"},
+	}
+	if err := db.Session().Create(&stale).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Session().Create(&models.Role{Name: "Clerk", Permissions: stale[:1]}).Error; err != nil {
+		t.Fatal(err)
+	}
+	// Seeding twice yields the same permissions.
+	for i := 0; i < 2; i++ {
+		if err := migrations.Seed(db.Session()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		seeded bool
+	}{
+		{"orders:list", true},
+		{"orders:list:same_region", true},
+		{"orders:export:same_region", true},
+		{"orders:*", true},
+		{"orders:*:same_region", true},
+		{"users:create", true},
+		{"users:update:lower_level", true},
+		{"images:create", true},
+		{"users:create:self", false},
+		{"images:list", false},
+		{"products:list:same_region", false},
+		{"audit_logs:delete", false},
+		// The stale permission held by a role and the one created by a user are kept.
+		{"orders:read", true},
+		{"orders:approve", false},
+		{"orders:delete", true},
+	}
+	for _, test := range tests {
+		var count int64
+		if err := db.Session().Model(&models.Permission{}).Where("name = ?", test.name).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+		if (count == 1) != test.seeded || count > 1 {
+			t.Errorf("%s: %d permissions, want seeded %v", test.name, count, test.seeded)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package migrations
+
+import (
+	"slices"
+
+	"github.com/lemadane/admin_backend_gofiber/authz"
+	"github.com/lemadane/admin_backend_gofiber/config"
+	"github.com/lemadane/admin_backend_gofiber/models"
+
+	"gorm.io/gorm"
+)
+
+// AdminRole is the name of the seeded role that holds every default permission.
+const AdminRole = "Admin"
+
+// AdminLevel is the level of the seeded admin role, above any role created without a level.
+const AdminLevel = 100
+
+// Seed creates the default permissions and the admin role so that a fresh database is usable.
+// For every resource it creates a permission per action that the routes check, as listed by
+// authz.ResourceActions, plus the "<resource>:*" wildcard, and the same permissions restricted by each
+// condition registered for the resource, except for creating rows, which conditions never restrict.
+// These permissions are marked as system permissions, and permissions seeded before they had a
+// description or category are completed without overwriting ones that were edited. System permissions
+// that are no longer seeded, such as those of earlier seeds for actions no route checks, are deleted
+// unless a role holds them.
+// The admin role is granted the unconditional wildcard of every resource, and the configured
+// registration role is created without any permissions. Both are marked as system roles.
+// It is idempotent: existing rows are kept and missing ones are added.
+func Seed(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		wildcards := make([]models.Permission, 0, len(authz.Resources))
+		seeded := make([]uint, 0)
+		for _, resource := range authz.Resources {
+			for _, action := range append(slices.Clone(authz.ResourceActions[resource]), authz.Wildcard) {
+				permission, err := seedPermission(tx, resource, action, "")
+				if err != nil {
+					return err
+				}
+				seeded = append(seeded, permission.Id)
+				if action == authz.Wildcard {
+					wildcards = append(wildcards, permission)
+				}
+				// Conditions only restrict existing rows, so they never apply to creating one.
+				if action == authz.ActionCreate {
+					continue
+				}
+				for _, condition := range authz.ConditionNames(resource) {
+					permission, err := seedPermission(tx, resource, action, condition)
+					if err != nil {
+						return err
+					}
+					seeded = append(seeded, permission.Id)
+				}
+			}
+		}
+		held := tx.Model(&models.RolePermission{}).Select("permission_id")
+		err := tx.Where("is_system = ? AND id NOT IN ? AND id NOT IN (?)", true, seeded, held).Delete(&models.Permission{}).Error
+		if err != nil {
+			return err
+		}
+		role, err := seedRole(tx, AdminRole, AdminLevel)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&role).Association("Permissions").Append(wildcards); err != nil {
+			return err
+		}
+		if name := config.Get().Auth.RegistrationRole; name != "" {
+			if _, err := seedRole(tx, name, 0); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// seedRole returns the system role with the given name, creating it at level if needed.
+// An existing role with that name keeps its level and is marked as a system role.
+func seedRole(tx *gorm.DB, name string, level uint) (models.Role, error) {
+	var role models.Role
+	err := tx.Where(&models.Role{Name: name}).Attrs(models.Role{Level: level, System: true}).FirstOrCreate(&role).Error
+	if err != nil || role.System {
+		return role, err
+	}
+	err = tx.Model(&role).Update("is_system", true).Error
+	return role, err
+}
+
+// seedPermission returns the permission granting action on resource under condition,
+// creating it if needed.
+func seedPermission(tx *gorm.DB, resource string, action authz.Action, condition string) (models.Permission, error) {
+	defaults := models.Permission{
+		Name:        authz.Name(resource, action, condition),
+		Resource:    resource,
+		Action:      string(action),
+		Condition:   condition,
+		Description: authz.Describe(resource, action, condition),
+		Category:    authz.Categories[resource],
+		System:      true,
+	}
+	var permission models.Permission
+	if err := tx.Where("name = ?", defaults.Name).Attrs(defaults).FirstOrCreate(&permission).Error; err != nil {
+		return permission, err
+	}
+	updates := map[string]interface{}{}
+	if !permission.System {
+		updates["is_system"] = true
+	}
+	if permission.Description == "" {
+		updates["description"] = defaults.Description
+	}
+	if permission.Category == "" {
+		updates["category"] = defaults.Category
+	}
+	if len(updates) == 0 {
+		return permission, nil
+	}
+	err := tx.Model(&permission).Updates(updates).Error
+	return permission, err
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// AuditLog records an administrative change: who made it, to what, and the state of the
+// target before and after the change as JSON.
+type AuditLog struct {
+	Id uint `json:"id"`
+	// ActorId is the ID of the user who made the change.
+	ActorId uint `json:"actor_id"`
+	// Action names the change, e.g. "users.roles.grant".
+	Action     string `json:"action"`
+	TargetType string `json:"target_type"`
+	TargetId   uint   `json:"target_id"`
+	// Before and After are the states of the target before and after the change, or only the
+	// fields that changed if both were known. Either is null when the target was created or deleted.
+	Before    JSON      `json:"before"`
+	After     JSON      `json:"after"`
+	Ip        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SortFields returns the columns that audit log entries may be sorted by.
+func (auditLog *AuditLog) SortFields() []string {
+	return []string{"id", "actor_id", "action", "target_type", "target_id", "created_at"}
+}
+
+// FilterFields returns the fields that audit log entries may be filtered by.
+func (auditLog *AuditLog) FilterFields() map[string]FilterField {
+	return map[string]FilterField{
+		"id":          {Column: "audit_logs.id", Kind: FilterNumber},
+		"actor_id":    {Column: "audit_logs.actor_id", Kind: FilterNumber},
+		"action":      {Column: "audit_logs.action", Kind: FilterString},
+		"target_type": {Column: "audit_logs.target_type", Kind: FilterString},
+		"target_id":   {Column: "audit_logs.target_id", Kind: FilterNumber},
+		"created_at":  {Column: "audit_logs.created_at", Kind: FilterTime},
+	}
+}
+
+// DefaultSort returns the default sort order of audit log entries, the most recent first.
+func (auditLog *AuditLog) DefaultSort() string {
+	return "-id"
+}
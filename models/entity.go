@@ -1,14 +1,61 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
 
-// Entity represents an entity in the system.
+// Entity describes how the entities of a model are listed: the columns they may be sorted by and the
+// fields they may be filtered by. Repositories load and count them.
 type Entity interface {
-	// Count returns the total count of entities in the database.
-	Count(db *gorm.DB) int64
-
-	// Take retrieves a subset of entities from the database.
-	// It takes the number of entities to retrieve (limit) and the offset to start from.
-	// It returns the retrieved entities.
-	Take(db *gorm.DB, limit int, offset int) interface{}
-}
\ No newline at end of file
+	// SortFields returns the columns that entities may be sorted by.
+	SortFields() []string
+
+	// DefaultSort returns the sort order used when none is requested, in the format of the sort
+	// query parameter, e.g. "-id" for the most recent first.
+	DefaultSort() string
+
+	// FilterFields returns the fields that entities may be filtered by, keyed by the name used in
+	// the filter query parameters.
+	FilterFields() map[string]FilterField
+}
+
+// FilterKind is the kind of values held by a filterable field. It determines how filter values are
+// parsed and which operators apply.
+type FilterKind int
+
+// Kinds of filterable fields.
+const (
+	FilterString FilterKind = iota
+	FilterNumber
+	FilterTime
+)
+
+// FilterField describes a field that list endpoints may filter entities by, as in filter[email][like]=@acme.com.
+type FilterField struct {
+	// Column is the column compared with the filter value, qualified with its table, e.g. "orders.email".
+	Column string
+	Kind   FilterKind
+	// Subquery, if set, is a condition on the entity's table with a %s placeholder for the condition on
+	// Column, for fields of related tables. Such a filter matches the entities with a matching related row.
+	Subquery string
+}
+
+// Scope restricts a query to the rows that the current request may access.
+// Row-level authorization policies are applied to queries as scopes.
+type Scope func(db *gorm.DB) *gorm.DB
+
+// Unrestricted is the Scope that leaves a query unchanged.
+func Unrestricted(db *gorm.DB) *gorm.DB {
+	return db
+}
+
+// AnyOf returns the condition that holds when any of exprs holds, to be used with Where.
+// gorm joins a single-element clause.Or to the preceding conditions of the query with OR rather than
+// AND, so a single condition is returned as is, and clause.Or only groups several.
+func AnyOf(exprs []clause.Expression) clause.Expression {
+	if len(exprs) == 1 {
+		return exprs[0]
+	}
+	return clause.Or(exprs...)
+}
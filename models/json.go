@@ -0,0 +1,53 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// JSON is a JSON document stored in a text column. It is rendered as the document itself rather than
+// as a string holding it. An empty document is stored as NULL and rendered as null.
+type JSON []byte
+
+// MarshalJSON implements json.Marshaler.
+func (document JSON) MarshalJSON() ([]byte, error) {
+	if len(document) == 0 {
+		return []byte("null"), nil
+	}
+	return document, nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (document *JSON) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*document = nil
+		return nil
+	}
+	*document = append((*document)[:0], data...)
+	return nil
+}
+
+// Value implements driver.Valuer. The document is written as text, which every supported database
+// stores in a text column.
+func (document JSON) Value() (driver.Value, error) {
+	if len(document) == 0 {
+		return nil, nil
+	}
+	return string(document), nil
+}
+
+// Scan implements sql.Scanner. Entries written before documents were stored as NULL hold an empty
+// string instead, which is read as an empty document.
+func (document *JSON) Scan(value interface{}) error {
+	switch value := value.(type) {
+	case nil:
+		*document = nil
+	case string:
+		*document = JSON(value)
+	case []byte:
+		*document = append(JSON(nil), value...)
+	default:
+		return fmt.Errorf("models: cannot scan %T into JSON", value)
+	}
+	return nil
+}
@@ -1,7 +1,5 @@
 package models
 
-import "gorm.io/gorm"
-
 // Order represents an order in the system.
 type Order struct {
 	Id         uint        `json:"id"`
@@ -9,6 +7,7 @@ type Order struct {
 	Lastname   string      `json:"-"`
 	Name       string      `json:"name" gorm:"-"`
 	Email      string      `json:"email"`
+	Region     string      `json:"region"`
 	Total      float32     `json:"total" gorm:"-"`
 	UpdatedAt  string      `json:"updated_at"`
 	CreatedAt  string      `json:"created_at"`
@@ -16,36 +15,53 @@ type Order struct {
 }
 
 // OrderItem represents an item in an order.
+// The title and price are those at the time of the order, so they are kept when the product changes.
 type OrderItem struct {
-	Id           uint    `json:"id"`
-	OrderId      uint    `json:"order_id"`
+	Id      uint `json:"id"`
+	OrderId uint `json:"order_id"`
+	// ProductId is the product of the catalog that was ordered, if any; older items only have a title.
+	ProductId    *uint   `json:"product_id"`
 	ProductTitle string  `json:"product_title"`
 	Price        float32 `json:"price"`
 	Quantity     uint    `json:"quantity"`
 }
 
-// Count returns the total number of records in the database for the given order.
-func (order *Order) Count(db *gorm.DB) int64 {
-	var total int64
-	db.Model(order).Count(&total)
+// SortFields returns the columns that orders may be sorted by.
+func (order *Order) SortFields() []string {
+	return []string{"id", "email", "region", "created_at", "updated_at"}
+}
 
-	return total
+// DefaultSort returns the default sort order of orders, by ID.
+func (order *Order) DefaultSort() string {
+	return "id"
+}
+
+// FilterFields returns the fields that orders may be filtered by, including the product titles of their items.
+func (order *Order) FilterFields() map[string]FilterField {
+	return map[string]FilterField{
+		"id":         {Column: "orders.id", Kind: FilterNumber},
+		"firstname":  {Column: "orders.firstname", Kind: FilterString},
+		"lastname":   {Column: "orders.lastname", Kind: FilterString},
+		"email":      {Column: "orders.email", Kind: FilterString},
+		"region":     {Column: "orders.region", Kind: FilterString},
+		"created_at": {Column: "orders.created_at", Kind: FilterTime},
+		"updated_at": {Column: "orders.updated_at", Kind: FilterTime},
+		"product_title": {
+			Column:   "order_items.product_title",
+			Kind:     FilterString,
+			Subquery: "orders.id IN (SELECT order_items.order_id FROM order_items WHERE %s)",
+		},
+	}
 }
 
-// Take retrieves a list of orders from the database with the specified limit and offset.
-// It calculates the total price for each order by summing the prices of all order items.
-// It also concatenates the first name and last name to form the order's name.
-// The retrieved orders are returned as a slice of Order structs.
-func (order *Order) Take(db *gorm.DB, limit int, offset int) interface{} {
-	var orders []Order
-	db.Preload("OrderItems").Offset(offset).Limit(limit).Find(&orders)
-	for i, _ := range orders {
-		var total float32
-		for _, item := range orders[i].OrderItems {
-			total += item.Price * float32(item.Quantity)
-		}
-		orders[i].Name = orders[i].Firstname + " " + orders[i].Lastname
-		orders[i].Total = total
+// AfterLoad computes the fields of an order that are not stored: its name, made of the first and
+// last names, and its total, the sum of the prices of its items.
+// It expects the order items to be loaded.
+func (order *Order) AfterLoad() {
+	var total float32
+	for _, item := range order.OrderItems {
+		total += item.Price * float32(item.Quantity)
 	}
-	return orders
+	order.Name = order.Firstname + " " + order.Lastname
+	order.Total = total
 }
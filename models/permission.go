@@ -1,7 +1,19 @@
 package models
 
 // Permission represents a permission entity.
+// It grants Action on Resource; either may be the wildcard "*".
+// Condition optionally names a row-level condition that restricts the grant to some rows,
+// such as "same_region"; an empty Condition grants the action on every row.
+// Name is the canonical "resource:action" or "resource:action:condition" form of the three.
 type Permission struct {
-	Id   uint   `json:"id"`
-	Name string `json:"name"`
+	Id        uint   `json:"id"`
+	Name      string `json:"name"`
+	Resource  string `json:"resource"`
+	Action    string `json:"action"`
+	Condition string `json:"condition" gorm:"column:condition_name"`
+	// Description and Category are shown in the role editor, which groups permissions by category.
+	Description string `json:"description"`
+	Category    string `json:"category"`
+	// System marks the permissions created by the seed command, which cannot be deleted.
+	System bool `json:"system" gorm:"column:is_system"`
 }
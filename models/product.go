@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Product represents a product of the catalog that orders are placed from.
+type Product struct {
+	Id          uint   `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// Image is the URL of the product's image, as returned by the upload endpoint.
+	Image string  `json:"image"`
+	Price float32 `json:"price"`
+	// Sku is the stock keeping unit, which identifies the product uniquely.
+	Sku string `json:"sku"`
+	// Stock is the number of units in stock.
+	Stock     uint      `json:"stock"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SortFields returns the columns that products may be sorted by.
+func (product *Product) SortFields() []string {
+	return []string{"id", "title", "sku", "price", "stock", "created_at", "updated_at"}
+}
+
+// DefaultSort returns the default sort order of products, by ID.
+func (product *Product) DefaultSort() string {
+	return "id"
+}
+
+// FilterFields returns the fields that products may be filtered by.
+func (product *Product) FilterFields() map[string]FilterField {
+	return map[string]FilterField{
+		"id":         {Column: "products.id", Kind: FilterNumber},
+		"title":      {Column: "products.title", Kind: FilterString},
+		"sku":        {Column: "products.sku", Kind: FilterString},
+		"stock":      {Column: "products.stock", Kind: FilterNumber},
+		"created_at": {Column: "products.created_at", Kind: FilterTime},
+		"updated_at": {Column: "products.updated_at", Kind: FilterTime},
+	}
+}
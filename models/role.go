@@ -4,5 +4,15 @@ package models
 type Role struct {
 	Id   uint   `json:"id"`
 	Name string `json:"name"`
+	// Level ranks the role; row-level conditions such as "lower_level" compare it.
+	Level uint `json:"level"`
+	// ParentId is the role this role inherits permissions from, if any.
+	ParentId    *uint        `json:"parent_id"`
 	Permissions []Permission `json:"permissions" gorm:"many2many:role_permissions"`
+	// PermissionsVersion is incremented whenever the role's permissions change.
+	// Access tokens embed it so that cached permissions can be trusted without a query.
+	PermissionsVersion uint `json:"-" gorm:"default:1"`
+	// System marks the roles created by the seed command, such as the admin and registration roles,
+	// which cannot be deleted.
+	System bool `json:"system" gorm:"column:is_system"`
 }
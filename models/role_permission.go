@@ -0,0 +1,7 @@
+package models
+
+// RolePermission assigns a permission to a role. It is the join table of Role.Permissions.
+type RolePermission struct {
+	RoleId       uint `json:"role_id" gorm:"primaryKey"`
+	PermissionId uint `json:"permission_id" gorm:"primaryKey"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Session represents a refresh token issued to a user.
+// Sessions created by rotating a refresh token share the FamilyId of the session
+// created at login, so that a whole login can be revoked at once.
+type Session struct {
+	Id           uint       `json:"id"`
+	FamilyId     string     `json:"family_id" gorm:"size:36;index"`
+	UserId       uint       `json:"user_id" gorm:"index"`
+	TokenHash    string     `json:"-" gorm:"size:64;uniqueIndex"`
+	UserAgent    string     `json:"user_agent"`
+	Ip           string     `json:"ip" gorm:"size:45"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	ReplacedById *uint      `json:"replaced_by_id"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// IsActive reports whether the session can still be used to refresh tokens.
+func (session *Session) IsActive(now time.Time) bool {
+	return session.RevokedAt == nil && now.Before(session.ExpiresAt)
+}
@@ -1,8 +1,9 @@
 package models
 
 import (
+	"time"
+
 	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
 )
 
 // User represents a user in the system.
@@ -12,20 +13,26 @@ type User struct {
 	Lastname  string `json:"lastname"`
 	Email     string `json:"email"`
 	PhoneNo   string `json:"phone_no"`
-	Password  string `json:"password"`
-	RoleId    uint   `json:"role_id"`
-	Role      Role   `json:"role" gorm:"foreignKey:RoleId"`
+	Region    string `json:"region"`
+	Password  string `json:"-"`
+	// Roles are the roles held by the user, whose permissions are combined.
+	Roles []Role `json:"roles" gorm:"many2many:user_roles"`
+	// CreatedAt and UpdatedAt are unknown for users created before they were recorded.
+	CreatedAt *time.Time `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
 }
 
 // SetPassword sets the password for the user by hashing the provided password.
 // It takes a string parameter `password` and updates the `Password` field of the `User` struct.
-// If an error occurs during the password hashing process, it panics.
-func (user *User) SetPassword(password string) {
+// It returns an error if the password cannot be hashed, e.g. bcrypt.ErrPasswordTooLong for a password
+// longer than 72 bytes, and leaves the user unchanged.
+func (user *User) SetPassword(password string) error {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	user.Password = string(hashedPassword)
+	return nil
 }
 
 // IsCorrectPassword checks if the provided password matches the user's stored password.
@@ -36,17 +43,54 @@ func (user *User) IsCorrectPassword(password string) bool {
 	return err == nil
 }
 
-// Take retrieves a list of users from the database with the specified limit and offset.
-// It returns the list of users as an interface{}.
-func (user *User) Take(db *gorm.DB, limit int, offset int) interface{} {
-	products := make([]User, 0)
-	db.Preload("Role").Offset(offset).Limit(limit).Find(&products)
-	return products
+// RoleIds returns the IDs of the user's roles.
+func (user *User) RoleIds() []uint {
+	ids := make([]uint, len(user.Roles))
+	for i, role := range user.Roles {
+		ids[i] = role.Id
+	}
+	return ids
+}
+
+// Level returns the highest level among the user's roles, or zero if the user holds no role.
+func (user *User) Level() uint {
+	var level uint
+	for _, role := range user.Roles {
+		if role.Level > level {
+			level = role.Level
+		}
+	}
+	return level
+}
+
+// SortFields returns the columns that users may be sorted by.
+func (user *User) SortFields() []string {
+	return []string{"id", "firstname", "lastname", "email", "region"}
 }
 
-// Count returns the total number of User records in the database.
-func (user *User) Count(gormDb *gorm.DB) int64 {
-	var count int64
-	gormDb.Model(&User{}).Count(&count)
-	return count
+// DefaultSort returns the default sort order of users, by ID.
+func (user *User) DefaultSort() string {
+	return "id"
+}
+
+// FilterFields returns the fields that users may be filtered by, including the IDs and names of their roles.
+func (user *User) FilterFields() map[string]FilterField {
+	return map[string]FilterField{
+		"id":        {Column: "users.id", Kind: FilterNumber},
+		"firstname": {Column: "users.firstname", Kind: FilterString},
+		"lastname":  {Column: "users.lastname", Kind: FilterString},
+		"email":     {Column: "users.email", Kind: FilterString},
+		"phone_no":  {Column: "users.phone_no", Kind: FilterString},
+		"region":    {Column: "users.region", Kind: FilterString},
+		"role_id": {
+			Column:   "user_roles.role_id",
+			Kind:     FilterNumber,
+			Subquery: "users.id IN (SELECT user_roles.user_id FROM user_roles WHERE %s)",
+		},
+		"role": {
+			Column:   "roles.name",
+			Kind:     FilterString,
+			Subquery: "users.id IN (SELECT user_roles.user_id FROM user_roles JOIN roles ON roles.id = user_roles.role_id WHERE %s)",
+		},
+	}
 }
@@ -0,0 +1,7 @@
+package models
+
+// UserRole assigns a role to a user. It is the join table of User.Roles.
+type UserRole struct {
+	UserId uint `json:"user_id" gorm:"primaryKey"`
+	RoleId uint `json:"role_id" gorm:"primaryKey"`
+}
@@ -0,0 +1,21 @@
+package repositories
+
+import "github.com/lemadane/admin_backend_gofiber/models"
+
+// The repositories of the models that handlers load and change.
+var (
+	Users = &Repository[models.User]{
+		Preloads:     []string{"Roles"},
+		Associations: []string{"Roles"},
+	}
+	Roles = &Repository[models.Role]{
+		Preloads:     []string{"Permissions"},
+		Associations: []string{"Permissions"},
+	}
+	Permissions = &Repository[models.Permission]{}
+	Orders      = &Repository[models.Order]{
+		Preloads: []string{"OrderItems"},
+	}
+	Products  = &Repository[models.Product]{}
+	AuditLogs = &Repository[models.AuditLog]{}
+)
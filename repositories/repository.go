@@ -0,0 +1,105 @@
+package repositories
+
+import (
+	"fmt"
+
+	"github.com/lemadane/admin_backend_gofiber/models"
+
+	"gorm.io/gorm"
+)
+
+// AfterLoader is implemented by models that compute fields once they are loaded, such as the name and
+// total of an order. Repositories call AfterLoad on every entity they return, after its associations are
+// preloaded.
+type AfterLoader interface {
+	AfterLoad()
+}
+
+// Repository provides the queries shared by every kind of entity, for entities of type T.
+// Its methods take the *gorm.DB to run on, so that they can be used inside a transaction, and the scope
+// restricting the visible entities, so that entities outside of it behave as missing.
+type Repository[T any] struct {
+	// Preloads are the associations loaded together with each entity, e.g. "Roles".
+	Preloads []string
+	// Associations are the many-to-many associations whose join rows are deleted together with an entity.
+	Associations []string
+}
+
+// Entity returns the models.Entity that describes how entities of type T are listed.
+// It panics if *T does not implement models.Entity, which is a programming error.
+func (repository *Repository[T]) Entity() models.Entity {
+	entity, ok := any(new(T)).(models.Entity)
+	if !ok {
+		panic(fmt.Sprintf("repositories: %T does not implement models.Entity", new(T)))
+	}
+	return entity
+}
+
+// List returns the entities visible through scope, skipping offset entities and returning at most limit;
+// a negative limit or offset disables it. The scope may also order the entities.
+func (repository *Repository[T]) List(db *gorm.DB, scope models.Scope, limit int, offset int) ([]T, error) {
+	entities := make([]T, 0)
+	if err := repository.query(db, scope).Offset(offset).Limit(limit).Find(&entities).Error; err != nil {
+		return nil, err
+	}
+	for i := range entities {
+		afterLoad(&entities[i])
+	}
+	return entities, nil
+}
+
+// Count returns the total number of entities visible through scope.
+func (repository *Repository[T]) Count(db *gorm.DB, scope models.Scope) (int64, error) {
+	var total int64
+	err := db.Model(new(T)).Scopes(scope).Count(&total).Error
+	return total, err
+}
+
+// Get returns the entity with the given ID. It returns gorm.ErrRecordNotFound if no such entity is
+// visible through scope.
+func (repository *Repository[T]) Get(db *gorm.DB, scope models.Scope, id uint) (T, error) {
+	var entity T
+	if err := repository.query(db, scope).First(&entity, id).Error; err != nil {
+		return entity, err
+	}
+	afterLoad(&entity)
+	return entity, nil
+}
+
+// Create inserts the entity, together with the associations it holds, and sets its ID.
+func (repository *Repository[T]) Create(db *gorm.DB, entity *T) error {
+	return db.Create(entity).Error
+}
+
+// Update saves the given columns of the entity, identified by its ID. Without columns, the fields of the
+// entity that are not zero are saved and the others are left unchanged.
+func (repository *Repository[T]) Update(db *gorm.DB, entity *T, columns ...string) error {
+	if len(columns) > 0 {
+		db = db.Select(columns)
+	}
+	return db.Model(entity).Updates(entity).Error
+}
+
+// Delete deletes the entity, identified by its ID, together with the join rows of its Associations.
+func (repository *Repository[T]) Delete(db *gorm.DB, entity *T) error {
+	if len(repository.Associations) > 0 {
+		db = db.Select(repository.Associations)
+	}
+	return db.Delete(entity).Error
+}
+
+// query returns a query on the entities visible through scope, with the repository's preloads.
+func (repository *Repository[T]) query(db *gorm.DB, scope models.Scope) *gorm.DB {
+	db = db.Scopes(scope)
+	for _, preload := range repository.Preloads {
+		db = db.Preload(preload)
+	}
+	return db
+}
+
+// afterLoad calls the AfterLoad hook of the entity, if it has one.
+func afterLoad[T any](entity *T) {
+	if loader, ok := any(entity).(AfterLoader); ok {
+		loader.AfterLoad()
+	}
+}
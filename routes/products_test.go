@@ -0,0 +1,64 @@
+package routes_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lemadane/admin_backend_gofiber/db"
+	"github.com/lemadane/admin_backend_gofiber/models"
+	"github.com/lemadane/admin_backend_gofiber/routes"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestProductSku(t *testing.T) {
+	// Each test starts with the products 1 and 2, whose SKUs are LAMP-1 and LAMP-2.
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		sku    string
+		status int
+		// skus are the SKUs of the stored products afterwards, by ID.
+		skus map[uint]string
+	}{
+		{name: "create with a new SKU", method: fiber.MethodPost, path: "/products", sku: "LAMP-3", status: fiber.StatusOK,
+			skus: map[uint]string{1: "LAMP-1", 2: "LAMP-2", 3: "LAMP-3"}},
+		{name: "create with a taken SKU", method: fiber.MethodPost, path: "/products", sku: "LAMP-1", status: fiber.StatusConflict,
+			skus: map[uint]string{1: "LAMP-1", 2: "LAMP-2"}},
+		{name: "update keeping the SKU", method: fiber.MethodPut, path: "/products/1", sku: "LAMP-1", status: fiber.StatusOK,
+			skus: map[uint]string{1: "LAMP-1", 2: "LAMP-2"}},
+		{name: "update to a new SKU", method: fiber.MethodPut, path: "/products/1", sku: "LAMP-3", status: fiber.StatusOK,
+			skus: map[uint]string{1: "LAMP-3", 2: "LAMP-2"}},
+		{name: "update to the SKU of another product", method: fiber.MethodPut, path: "/products/1", sku: "LAMP-2", status: fiber.StatusConflict,
+			skus: map[uint]string{1: "LAMP-1", 2: "LAMP-2"}},
+		{name: "update a missing product", method: fiber.MethodPut, path: "/products/999", sku: "LAMP-3", status: fiber.StatusNotFound,
+			skus: map[uint]string{1: "LAMP-1", 2: "LAMP-2"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := setup(t)
+			token, _ := register(t, app, "ada@example.com", "Admin")
+			products := []models.Product{{Title: "Desk lamp", Sku: "LAMP-1"}, {Title: "Floor lamp", Sku: "LAMP-2"}}
+			if err := db.Session().Create(&products).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			status, body := call(t, app, test.method, routes.Prefix+test.path, `{"title":"Lamp","price":25,"sku":"`+test.sku+`"}`, token)
+			if status != test.status {
+				t.Fatalf("status %d, want %d: %s", status, test.status, body)
+			}
+			var stored []models.Product
+			if err := db.Session().Find(&stored).Error; err != nil {
+				t.Fatal(err)
+			}
+			skus := map[uint]string{}
+			for _, product := range stored {
+				skus[product.Id] = product.Sku
+			}
+			if !reflect.DeepEqual(skus, test.skus) {
+				t.Errorf("SKUs = %v, want %v", skus, test.skus)
+			}
+		})
+	}
+}
@@ -0,0 +1,321 @@
+package routes_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/lemadane/admin_backend_gofiber/db"
+	"github.com/lemadane/admin_backend_gofiber/models"
+	"github.com/lemadane/admin_backend_gofiber/routes"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// findRole returns the stored role with the given name.
+func findRole(t *testing.T, name string) models.Role {
+	t.Helper()
+	var role models.Role
+	if err := db.Session().Where("name = ?", name).First(&role).Error; err != nil {
+		t.Fatal(err)
+	}
+	return role
+}
+
+// permissionIds returns the IDs of the seeded permissions with the given names. A name that is not
+// seeded stands for an ID that does not exist.
+func permissionIds(t *testing.T, names []string) []uint {
+	t.Helper()
+	ids := make([]uint, len(names))
+	for i, name := range names {
+		var permission models.Permission
+		err := db.Session().Where("name = ?", name).Limit(1).Find(&permission).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = permission.Id
+		if ids[i] == 0 {
+			ids[i] = 999
+		}
+	}
+	return ids
+}
+
+// names returns the sorted names of permissions.
+func names(permissions []models.Permission) []string {
+	found := make([]string, len(permissions))
+	for i, permission := range permissions {
+		found[i] = permission.Name
+	}
+	sort.Strings(found)
+	return found
+}
+
+func TestUpdateRole(t *testing.T) {
+	// Each test starts with the role Clerk, holding products:list and products:read, and the role Junior,
+	// which inherits from Clerk.
+	tests := []struct {
+		name string
+		// role is the name of the role to update; "" stands for a role that does not exist.
+		role string
+		// ifMatch is the If-Match header: "current" sends the ETag returned by GET.
+		ifMatch string
+		// rename, parent and permissions make up the request: the new name of the role, the name of
+		// its new parent and the names of its new permissions.
+		rename      string
+		parent      string
+		permissions []string
+		status      int
+		// added and removed are the permissions reported by the response, for 200.
+		added   []string
+		removed []string
+		// bumped tells whether the permissions version of Clerk and Junior is incremented.
+		bumped bool
+	}{
+		{
+			name: "added and removed permissions", role: "Clerk",
+			rename: "Clerk", permissions: []string{"products:read", "products:update"},
+			status: fiber.StatusOK, added: []string{"products:update"}, removed: []string{"products:list"}, bumped: true,
+		},
+		{
+			name: "unchanged permissions", role: "Clerk",
+			rename: "Senior clerk", permissions: []string{"products:read", "products:list"},
+			status: fiber.StatusOK, added: []string{}, removed: []string{},
+		},
+		{
+			name: "every permission removed", role: "Clerk",
+			rename: "Clerk", permissions: []string{},
+			status: fiber.StatusOK, added: []string{}, removed: []string{"products:list", "products:read"}, bumped: true,
+		},
+		{
+			name: "current If-Match", role: "Clerk", ifMatch: "current",
+			rename: "Clerk", permissions: []string{"products:list", "products:read", "products:update"},
+			status: fiber.StatusOK, added: []string{"products:update"}, removed: []string{}, bumped: true,
+		},
+		{
+			name: "stale If-Match", role: "Clerk", ifMatch: `W/"stale"`,
+			rename: "Clerk", permissions: []string{"products:update"},
+			status: fiber.StatusPreconditionFailed,
+		},
+		{
+			name: "missing role", role: "",
+			rename: "Clerk", permissions: []string{"products:list"},
+			status: fiber.StatusNotFound,
+		},
+		{
+			name: "name of another role", role: "Clerk",
+			rename: "Admin", permissions: []string{"products:list"},
+			status: fiber.StatusConflict,
+		},
+		{
+			name: "unknown permission", role: "Clerk",
+			rename: "Clerk", permissions: []string{"products:list", "products:unknown"},
+			status: fiber.StatusUnprocessableEntity,
+		},
+		{
+			name: "descendant as parent", role: "Clerk",
+			rename: "Clerk", parent: "Junior", permissions: []string{"products:list"},
+			status: fiber.StatusUnprocessableEntity,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := setup(t)
+			token, _ := register(t, app, "ada@example.com", "Admin")
+			clerk := findRole(t, createRole(t, "Clerk", "products:list", "products:read"))
+			junior := models.Role{Name: "Junior", ParentId: &clerk.Id}
+			if err := db.Session().Create(&junior).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			path := fmt.Sprintf("%s/roles/%d", routes.Prefix, 999)
+			if test.role != "" {
+				path = fmt.Sprintf("%s/roles/%d", routes.Prefix, findRole(t, test.role).Id)
+			}
+			headers := map[string]string{}
+			if test.ifMatch == "current" {
+				_, header, body := send(t, app, fiber.MethodGet, path, "", token, nil)
+				if header.Get(fiber.HeaderETag) == "" {
+					t.Fatalf("get role: no ETag: %s", body)
+				}
+				headers[fiber.HeaderIfMatch] = header.Get(fiber.HeaderETag)
+			} else if test.ifMatch != "" {
+				headers[fiber.HeaderIfMatch] = test.ifMatch
+			}
+			request := map[string]interface{}{"name": test.rename, "permissions": permissionIds(t, test.permissions)}
+			if test.parent != "" {
+				request["parent_id"] = findRole(t, test.parent).Id
+			}
+			data, err := json.Marshal(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			status, _, body := send(t, app, fiber.MethodPut, path, string(data), token, headers)
+			if status != test.status {
+				t.Fatalf("status %d, want %d: %s", status, test.status, body)
+			}
+			version := uint(1)
+			if test.bumped {
+				version = 2
+			}
+			for _, role := range []models.Role{clerk, junior} {
+				var stored models.Role
+				if err := db.Session().First(&stored, role.Id).Error; err != nil {
+					t.Fatal(err)
+				}
+				if stored.PermissionsVersion != version {
+					t.Errorf("%s: permissions version %d, want %d", role.Name, stored.PermissionsVersion, version)
+				}
+			}
+			if status != fiber.StatusOK {
+				stored := models.Role{Id: clerk.Id}
+				if err := db.Session().Model(&stored).Association("Permissions").Find(&stored.Permissions); err != nil {
+					t.Fatal(err)
+				}
+				if got := names(stored.Permissions); !reflect.DeepEqual(got, []string{"products:list", "products:read"}) {
+					t.Errorf("permissions after a failed update = %v, want them unchanged", got)
+				}
+				return
+			}
+			var update struct {
+				Name        string              `json:"name"`
+				Permissions []models.Permission `json:"permissions"`
+				Added       []models.Permission `json:"added"`
+				Removed     []models.Permission `json:"removed"`
+			}
+			if err := json.Unmarshal(body, &update); err != nil {
+				t.Fatal(err)
+			}
+			if update.Name != test.rename {
+				t.Errorf("name = %q, want %q", update.Name, test.rename)
+			}
+			wantPermissions := append([]string{}, test.permissions...)
+			sort.Strings(wantPermissions)
+			if got := names(update.Permissions); !reflect.DeepEqual(got, wantPermissions) {
+				t.Errorf("permissions = %v, want %v", got, wantPermissions)
+			}
+			if got := names(update.Added); !reflect.DeepEqual(got, test.added) {
+				t.Errorf("added = %v, want %v", got, test.added)
+			}
+			if got := names(update.Removed); !reflect.DeepEqual(got, test.removed) {
+				t.Errorf("removed = %v, want %v", got, test.removed)
+			}
+		})
+	}
+}
+
+func TestDeleteRole(t *testing.T) {
+	// Each test starts with the role Clerk, which inherits from Base and is inherited by Junior, and the
+	// role Other. Bob holds Clerk and Carol holds Clerk and Other; Junior is held by nobody.
+	tests := []struct {
+		name string
+		// role is the name of the role to delete; "" stands for a role that does not exist.
+		role string
+		// reassignTo is the name of the role passed in reassign_to, and query a raw query string
+		// sent instead.
+		reassignTo string
+		query      string
+		status     int
+	}{
+		{name: "held role", role: "Clerk", status: fiber.StatusConflict},
+		{name: "held role reassigned", role: "Clerk", reassignTo: "Other", status: fiber.StatusNoContent},
+		{name: "role held by nobody", role: "Junior", status: fiber.StatusNoContent},
+		{name: "admin role", role: "Admin", reassignTo: "Other", status: fiber.StatusConflict},
+		{name: "registration role", role: "User", reassignTo: "Other", status: fiber.StatusConflict},
+		{name: "reassigned to itself", role: "Clerk", reassignTo: "Clerk", status: fiber.StatusUnprocessableEntity},
+		{name: "reassigned to a missing role", role: "Clerk", query: "reassign_to=999", status: fiber.StatusUnprocessableEntity},
+		{name: "malformed reassign_to", role: "Clerk", query: "reassign_to=other", status: fiber.StatusUnprocessableEntity},
+		{name: "missing role", role: "", status: fiber.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := setup(t)
+			token, _ := register(t, app, "ada@example.com", "Admin")
+			base := findRole(t, createRole(t, "Base"))
+			clerk := findRole(t, createRole(t, "Clerk", "products:read"))
+			if err := db.Session().Model(&clerk).Update("parent_id", base.Id).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Session().Create(&models.Role{Name: "Junior", ParentId: &clerk.Id}).Error; err != nil {
+				t.Fatal(err)
+			}
+			other := findRole(t, createRole(t, "Other", "orders:list"))
+			register(t, app, "bob@example.com", "Clerk")
+			register(t, app, "carol@example.com", "Clerk", "Other")
+
+			var role models.Role
+			path := fmt.Sprintf("%s/roles/%d", routes.Prefix, 999)
+			if test.role != "" {
+				role = findRole(t, test.role)
+				path = fmt.Sprintf("%s/roles/%d", routes.Prefix, role.Id)
+			}
+			if test.reassignTo != "" {
+				path += fmt.Sprintf("?reassign_to=%d", findRole(t, test.reassignTo).Id)
+			} else if test.query != "" {
+				path += "?" + test.query
+			}
+
+			status, body := call(t, app, fiber.MethodDelete, path, "", token)
+			if status != test.status {
+				t.Fatalf("status %d, want %d: %s", status, test.status, body)
+			}
+			var remaining int64
+			if err := db.Session().Model(&models.Role{}).Where("id = ?", role.Id).Count(&remaining).Error; err != nil {
+				t.Fatal(err)
+			}
+			if status != fiber.StatusNoContent {
+				if test.role != "" && remaining != 1 {
+					t.Errorf("the role was deleted by a failed request")
+				}
+				return
+			}
+			if remaining != 0 {
+				t.Fatal("the role was not deleted")
+			}
+
+			// The assignments of the role are deleted with it.
+			for _, table := range []interface{}{&models.UserRole{}, &models.RolePermission{}} {
+				var count int64
+				if err := db.Session().Model(table).Where("role_id = ?", role.Id).Count(&count).Error; err != nil {
+					t.Fatal(err)
+				}
+				if count != 0 {
+					t.Errorf("%T: %d rows of the deleted role remain", table, count)
+				}
+			}
+			if test.role != "Clerk" {
+				return
+			}
+			// The roles inheriting from the deleted role inherit from its parent instead.
+			junior := findRole(t, "Junior")
+			if junior.ParentId == nil || *junior.ParentId != base.Id {
+				t.Errorf("Junior inherits from %v, want %d", junior.ParentId, base.Id)
+			}
+			// Every holder holds the role reassigned to once, and each reassignment is audited.
+			for _, email := range []string{"bob@example.com", "carol@example.com"} {
+				var user models.User
+				if err := db.Session().Where("email = ?", email).First(&user).Error; err != nil {
+					t.Fatal(err)
+				}
+				var count int64
+				if err := db.Session().Model(&models.UserRole{}).Where("user_id = ? AND role_id = ?", user.Id, other.Id).Count(&count).Error; err != nil {
+					t.Fatal(err)
+				}
+				if count != 1 {
+					t.Errorf("%s holds Other %d times, want once", email, count)
+				}
+				if err := db.Session().Model(&models.AuditLog{}).
+					Where("action = ? AND target_type = ? AND target_id = ?", "users.roles.reassign", "users", user.Id).
+					Count(&count).Error; err != nil {
+					t.Fatal(err)
+				}
+				if count != 1 {
+					t.Errorf("%s: %d reassignments audited, want 1", email, count)
+				}
+			}
+		})
+	}
+}
@@ -1,11 +1,176 @@
 package routes
 
 import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lemadane/admin_backend_gofiber/authz"
+	"github.com/lemadane/admin_backend_gofiber/config"
 	"github.com/lemadane/admin_backend_gofiber/controllers"
+	"github.com/lemadane/admin_backend_gofiber/middlewares"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 )
 
-func Setup(app *fiber.App) {
+// Prefix is the path prefix shared by every versioned API route.
+const Prefix = "/api/v1"
+
+// Setup registers the complete route table on the given Fiber app.
+// Public routes are registered first so that they are matched before the
+// authenticated group, whose IsAuthenticated middleware guards everything
+// registered after it under the same prefix. Every authenticated route declares
+// a policy, and Setup fails if any API route was registered without one.
+func Setup(app *fiber.App) error {
+	app.Use(requestid.New())
 	app.Get("/ping", controllers.Ping)
+	app.Static("/api/uploads", config.Get().Uploads.Dir)
+
+	api := app.Group(Prefix)
+	table := newRouteTable()
+
+	table.public(api, fiber.MethodGet, "/ping", "ping", controllers.Ping)
+	table.public(api, fiber.MethodGet, "/routes", "routes.list", listRoutes(app))
+	table.public(api, fiber.MethodPost, "/register", "auth.register", controllers.Register)
+	table.public(api, fiber.MethodPost, "/login", "auth.login", controllers.Login)
+	table.public(api, fiber.MethodPost, "/auth/refresh", "auth.refresh", controllers.Refresh)
+	table.public(api, fiber.MethodPost, "/logout", "auth.logout", controllers.Logout)
+
+	auth := api.Group("", middlewares.IsAuthenticated)
+	self := middlewares.AnyAuthenticated
+	allow := middlewares.Permission
+
+	table.protected(auth, fiber.MethodPut, "/users/info", "self.info", self, controllers.UpdateInfo)
+	table.protected(auth, fiber.MethodPut, "/users/password", "self.password", self, controllers.UpdatePassword)
+	table.protected(auth, fiber.MethodGet, "/users/:id/profile", "users.profile", self, controllers.GetUserProfile)
+
+	table.protected(auth, fiber.MethodGet, "/users", "users.list", allow("users", authz.ActionList), controllers.AllUsers)
+	table.protected(auth, fiber.MethodPost, "/users", "users.create", allow("users", authz.ActionCreate), controllers.CreateUser)
+	table.protected(auth, fiber.MethodGet, "/users/:id", "users.get", allow("users", authz.ActionRead), controllers.GetUser)
+	table.protected(auth, fiber.MethodPut, "/users/:id", "users.update", allow("users", authz.ActionUpdate), controllers.UpdateUser)
+	table.protected(auth, fiber.MethodDelete, "/users/:id", "users.delete", allow("users", authz.ActionDelete), controllers.DeleteUser)
+	table.protected(auth, fiber.MethodPost, "/users/:id/roles", "users.roles.grant", allow("users", authz.ActionUpdate), controllers.GrantRole)
+	table.protected(auth, fiber.MethodDelete, "/users/:id/roles/:roleId", "users.roles.revoke", allow("users", authz.ActionUpdate), controllers.RevokeRole)
+
+	table.protected(auth, fiber.MethodGet, "/roles", "roles.list", allow("roles", authz.ActionList), controllers.AllRoles)
+	table.protected(auth, fiber.MethodPost, "/roles", "roles.create", allow("roles", authz.ActionCreate), controllers.CreateRole)
+	table.protected(auth, fiber.MethodGet, "/roles/:id", "roles.get", allow("roles", authz.ActionRead), controllers.GetRole)
+	table.protected(auth, fiber.MethodGet, "/roles/:id/permissions", "roles.permissions", allow("roles", authz.ActionRead), controllers.RolePermissions)
+	table.protected(auth, fiber.MethodPut, "/roles/:id", "roles.update", allow("roles", authz.ActionUpdate), controllers.UpdateRole)
+	table.protected(auth, fiber.MethodDelete, "/roles/:id", "roles.delete", allow("roles", authz.ActionDelete), controllers.DeleteRole)
+
+	table.protected(auth, fiber.MethodGet, "/permissions", "permissions.list", allow("permissions", authz.ActionList), controllers.AllPermissions)
+	table.protected(auth, fiber.MethodGet, "/permissions/matrix", "permissions.matrix", allow("permissions", authz.ActionList), controllers.PermissionMatrix)
+	table.protected(auth, fiber.MethodGet, "/permissions/:id", "permissions.get", allow("permissions", authz.ActionRead), controllers.GetPermission)
+	table.protected(auth, fiber.MethodPost, "/permissions", "permissions.create", allow("permissions", authz.ActionCreate), controllers.CreatePermission)
+	table.protected(auth, fiber.MethodPut, "/permissions/:id", "permissions.update", allow("permissions", authz.ActionUpdate), controllers.UpdatePermission)
+	table.protected(auth, fiber.MethodDelete, "/permissions/:id", "permissions.delete", allow("permissions", authz.ActionDelete), controllers.DeletePermission)
+
+	table.protected(auth, fiber.MethodPost, "/upload", "images.upload", allow("images", authz.ActionCreate), controllers.UploadImage)
+
+	table.protected(auth, fiber.MethodGet, "/products", "products.list", allow("products", authz.ActionList), controllers.AllProducts)
+	table.protected(auth, fiber.MethodPost, "/products", "products.create", allow("products", authz.ActionCreate), controllers.CreateProduct)
+	table.protected(auth, fiber.MethodGet, "/products/:id", "products.get", allow("products", authz.ActionRead), controllers.GetProduct)
+	table.protected(auth, fiber.MethodPut, "/products/:id", "products.update", allow("products", authz.ActionUpdate), controllers.UpdateProduct)
+	table.protected(auth, fiber.MethodDelete, "/products/:id", "products.delete", allow("products", authz.ActionDelete), controllers.DeleteProduct)
+
+	table.protected(auth, fiber.MethodGet, "/orders", "orders.list", allow("orders", authz.ActionList), controllers.AllOrders)
+	table.protected(auth, fiber.MethodPost, "/export", "orders.export", allow("orders", authz.ActionExport), controllers.Export)
+	table.protected(auth, fiber.MethodGet, "/chart", "orders.chart", allow("orders", authz.ActionList), controllers.Chart)
+
+	// Search covers several resources, and only searches those that the user may list.
+	table.protected(auth, fiber.MethodGet, "/search", "search", self, controllers.Search)
+
+	table.protected(auth, fiber.MethodGet, "/audit-logs", "audit_logs.list", allow("audit_logs", authz.ActionList), controllers.AllAuditLogs)
+
+	return table.verify(app)
+}
+
+// routeTable registers API routes and remembers how each of them is protected.
+type routeTable struct {
+	// declared holds the names of the routes registered through the table.
+	declared map[string]bool
+	errs     []error
+}
+
+func newRouteTable() *routeTable {
+	return &routeTable{
+		declared: map[string]bool{},
+	}
+}
+
+// public registers a route that needs no authentication.
+func (table *routeTable) public(router fiber.Router, method string, path string, name string, handler fiber.Handler) {
+	router.Add(method, path, handler).Name(name)
+	table.declare(name)
+}
+
+// protected registers a route on an authenticated router, guarded by the policy.
+// Routes that change anything, i.e. those not registered for GET, are recorded in the audit log
+// under the route name.
+func (table *routeTable) protected(router fiber.Router, method string, path string, name string, policy middlewares.Policy, handler fiber.Handler) {
+	if err := policy.Validate(); err != nil {
+		table.errs = append(table.errs, fmt.Errorf("route %s %s: %w", method, path, err))
+	}
+	handlers := []fiber.Handler{middlewares.Enforce(policy)}
+	if method != fiber.MethodGet {
+		handlers = append(handlers, middlewares.Audit(name))
+	}
+	router.Add(method, path, append(handlers, handler)...).Name(name)
+	table.declare(name)
+}
+
+func (table *routeTable) declare(name string) {
+	if table.declared[name] {
+		table.errs = append(table.errs, fmt.Errorf("route name %q is declared twice", name))
+	}
+	table.declared[name] = true
+}
+
+// verify checks that every API route on the app was registered through the table,
+// so that no route under the prefix can bypass its authorization policy.
+func (table *routeTable) verify(app *fiber.App) error {
+	for _, route := range app.GetRoutes(true) {
+		if route.Method == fiber.MethodHead || !strings.HasPrefix(route.Path, Prefix) {
+			continue
+		}
+		if !table.declared[route.Name] {
+			table.errs = append(table.errs, fmt.Errorf("route %s %s has no authorization policy", route.Method, route.Path))
+		}
+	}
+	return errors.Join(table.errs...)
+}
+
+// RouteInfo describes a single registered route for the route listing endpoint.
+type RouteInfo struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Name   string `json:"name"`
+}
+
+// listRoutes returns a handler that lists every named route registered on the app.
+// Middleware registrations and the implicit HEAD routes Fiber adds for GET are omitted.
+func listRoutes(app *fiber.App) fiber.Handler {
+	return func(context *fiber.Ctx) error {
+		routes := make([]RouteInfo, 0)
+		for _, route := range app.GetRoutes(true) {
+			if route.Method == fiber.MethodHead || route.Name == "" {
+				continue
+			}
+			routes = append(routes, RouteInfo{
+				Method: route.Method,
+				Path:   route.Path,
+				Name:   route.Name,
+			})
+		}
+		sort.Slice(routes, func(i, j int) bool {
+			if routes[i].Path == routes[j].Path {
+				return routes[i].Method < routes[j].Method
+			}
+			return routes[i].Path < routes[j].Path
+		})
+		return context.JSON(routes)
+	}
 }
@@ -0,0 +1,400 @@
+package routes_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lemadane/admin_backend_gofiber/apierror"
+	"github.com/lemadane/admin_backend_gofiber/config"
+	"github.com/lemadane/admin_backend_gofiber/db"
+	"github.com/lemadane/admin_backend_gofiber/internal/testdb"
+	"github.com/lemadane/admin_backend_gofiber/migrations"
+	"github.com/lemadane/admin_backend_gofiber/models"
+	"github.com/lemadane/admin_backend_gofiber/routes"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// setup returns an app serving the complete route table from a seeded test database.
+func setup(t *testing.T) *fiber.App {
+	t.Helper()
+	cfg := testdb.Setup(t)
+	cfg.Uploads.Dir = t.TempDir()
+	if err := migrations.Seed(db.Session()); err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.Handler})
+	if err := routes.Setup(app); err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+// call sends a JSON request to app and returns the status and body of the response.
+func call(t *testing.T, app *fiber.App, method string, path string, body string, token string) (int, []byte) {
+	t.Helper()
+	status, _, data := send(t, app, method, path, body, token, nil)
+	return status, data
+}
+
+// send sends a JSON request with the given headers to app and returns the status, headers and body of
+// the response.
+func send(t *testing.T, app *fiber.App, method string, path string, body string, token string, headers map[string]string) (int, http.Header, []byte) {
+	t.Helper()
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if token != "" {
+		request.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	}
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	response, err := app.Test(request, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response.StatusCode, response.Header, data
+}
+
+// passwordKeys returns the path of every key of a decoded JSON value that names a password.
+func passwordKeys(value interface{}, path string) []string {
+	var found []string
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if strings.Contains(strings.ToLower(key), "password") {
+				found = append(found, path+"."+key)
+			}
+			found = append(found, passwordKeys(child, path+"."+key)...)
+		}
+	case []interface{}:
+		for i, child := range value {
+			found = append(found, passwordKeys(child, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	return found
+}
+
+// password is the password of the users registered by the tests.
+const password = "Secret-123"
+
+// register registers a user with the given email through the API, grants them the given roles
+// besides the registration role, and signs them in. It returns the access token and the responses
+// of the register and login endpoints, by name.
+func register(t *testing.T, app *fiber.App, email string, roles ...string) (string, map[string][]byte) {
+	t.Helper()
+	status, body := call(t, app, fiber.MethodPost, routes.Prefix+"/register",
+		`{"firstname":"Test","email":"`+email+`","password":"`+password+`","password_confirm":"`+password+`"}`, "")
+	if status != fiber.StatusOK {
+		t.Fatalf("register: status %d: %s", status, body)
+	}
+	responses := map[string][]byte{"register": body}
+	var user models.User
+	if err := json.Unmarshal(body, &user); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range roles {
+		var role models.Role
+		if err := db.Session().Where("name = ?", name).First(&role).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Session().Create(&models.UserRole{UserId: user.Id, RoleId: role.Id}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	status, body = call(t, app, fiber.MethodPost, routes.Prefix+"/login?token=true",
+		`{"email":"`+email+`","password":"`+password+`"}`, "")
+	if status != fiber.StatusOK {
+		t.Fatalf("login: status %d: %s", status, body)
+	}
+	responses["login"] = body
+	var login struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(body, &login); err != nil {
+		t.Fatal(err)
+	}
+	return login.Token, responses
+}
+
+func TestUserEndpointsNeverRenderPasswords(t *testing.T) {
+	app := setup(t)
+	token, responses := register(t, app, "ada@example.com", "Admin")
+	var user models.Role
+	if err := db.Session().Where("name = ?", config.Get().Auth.RegistrationRole).First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// The steps run in order against the same database: the user created by one is assigned roles by the next.
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"get user", fiber.MethodGet, "/users/1", "", fiber.StatusOK},
+		{"list users", fiber.MethodGet, "/users", "", fiber.StatusOK},
+		{"get profile", fiber.MethodGet, "/users/1/profile", "", fiber.StatusOK},
+		{"create user", fiber.MethodPost, "/users",
+			`{"firstname":"Bob","email":"bob@example.com","password":"` + password + `"}`, fiber.StatusOK},
+		{"update info", fiber.MethodPut, "/users/info", `{"phone_no":"555-0100"}`, fiber.StatusOK},
+		{"update password", fiber.MethodPut, "/users/password",
+			`{"password":"Other-456","password_confirm":"Other-456"}`, fiber.StatusOK},
+		{"grant role", fiber.MethodPost, "/users/2/roles", fmt.Sprintf(`{"role_id":%d}`, user.Id), fiber.StatusOK},
+		{"revoke role", fiber.MethodDelete, fmt.Sprintf("/users/2/roles/%d", user.Id), "", fiber.StatusOK},
+		{"search", fiber.MethodGet, "/search?q=example", "", fiber.StatusOK},
+	}
+	for _, step := range steps {
+		status, body := call(t, app, step.method, routes.Prefix+step.path, step.body, token)
+		if status != step.status {
+			t.Fatalf("%s: status %d, want %d: %s", step.name, status, step.status, body)
+		}
+		responses[step.name] = body
+	}
+
+	// The public profile is shown to users without rights on the user, so it holds no contact details.
+	var profile map[string]interface{}
+	if err := json.Unmarshal(responses["get profile"], &profile); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"email", "phone_no", "region", "roles"} {
+		if _, ok := profile[key]; ok {
+			t.Errorf("get profile: response contains %q: %s", key, responses["get profile"])
+		}
+	}
+
+	for name, body := range responses {
+		if strings.Contains(string(body), "$2a$") {
+			t.Errorf("%s: response contains a password hash: %s", name, body)
+		}
+		var decoded interface{}
+		if err := json.Unmarshal(body, &decoded); err != nil {
+			t.Fatalf("%s: %v: %s", name, err, body)
+		}
+		if keys := passwordKeys(decoded, ""); len(keys) > 0 {
+			t.Errorf("%s: response contains %v: %s", name, keys, body)
+		}
+	}
+}
+
+func TestUpdateTakenEmail(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		status int
+	}{
+		{name: "email of another user", path: "/users/2", body: `{"email":"ada@example.com"}`, status: fiber.StatusUnprocessableEntity},
+		{name: "same email", path: "/users/2", body: `{"email":"bob@example.com"}`, status: fiber.StatusOK},
+		{name: "own email taken by another user", path: "/users/info", body: `{"email":"bob@example.com"}`, status: fiber.StatusUnprocessableEntity},
+		{name: "own email kept", path: "/users/info", body: `{"email":"ada@example.com"}`, status: fiber.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := setup(t)
+			token, _ := register(t, app, "ada@example.com", "Admin")
+			register(t, app, "bob@example.com")
+
+			status, body := call(t, app, fiber.MethodPut, routes.Prefix+test.path, test.body, token)
+			if status != test.status {
+				t.Fatalf("status %d, want %d: %s", status, test.status, body)
+			}
+			if test.status != fiber.StatusUnprocessableEntity {
+				return
+			}
+			var apiErr apierror.Error
+			if err := json.Unmarshal(body, &apiErr); err != nil {
+				t.Fatal(err)
+			}
+			if got := apiErr.Fields["email"]; got != "is already taken" {
+				t.Errorf("email error = %q, want %q", got, "is already taken")
+			}
+		})
+	}
+}
+
+func TestUnknownIds(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		status int
+		// field is the field reported as invalid, for 422.
+		field string
+	}{
+		{name: "known roles", path: "/users", body: `{"firstname":"Bob","email":"bob@example.com","password":"` + password + `","role_ids":[1,2,1]}`, status: fiber.StatusOK},
+		{name: "unknown role", path: "/users", body: `{"firstname":"Bob","email":"bob@example.com","password":"` + password + `","role_ids":[1,999]}`, status: fiber.StatusUnprocessableEntity, field: "role_ids[1]"},
+		{name: "known permissions", path: "/roles", body: `{"name":"Clerk","permissions":[1,2]}`, status: fiber.StatusOK},
+		{name: "unknown permission", path: "/roles", body: `{"name":"Clerk","permissions":[999,1]}`, status: fiber.StatusUnprocessableEntity, field: "permissions[0]"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := setup(t)
+			token, _ := register(t, app, "ada@example.com", "Admin")
+
+			status, body := call(t, app, fiber.MethodPost, routes.Prefix+test.path, test.body, token)
+			if status != test.status {
+				t.Fatalf("status %d, want %d: %s", status, test.status, body)
+			}
+			if test.field == "" {
+				return
+			}
+			var apiErr apierror.Error
+			if err := json.Unmarshal(body, &apiErr); err != nil {
+				t.Fatal(err)
+			}
+			if got := apiErr.Fields[test.field]; got != "does not exist" {
+				t.Errorf("%s error = %q in %v, want %q", test.field, got, apiErr.Fields, "does not exist")
+			}
+		})
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	app := setup(t)
+	token, _ := register(t, app, "ada@example.com", "Admin")
+
+	// No GET route is audited, whatever it responds.
+	for _, route := range app.GetRoutes(true) {
+		if route.Method != fiber.MethodGet || !strings.HasPrefix(route.Path, routes.Prefix) {
+			continue
+		}
+		path := route.Path
+		for _, param := range route.Params {
+			path = strings.Replace(path, ":"+param, "1", 1)
+		}
+		call(t, app, fiber.MethodGet, path, "", token)
+	}
+	var count int64
+	if err := db.Session().Model(&models.AuditLog{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("GET routes wrote %d audit log entries", count)
+	}
+
+	status, body := call(t, app, fiber.MethodPut, routes.Prefix+"/users/1", `{"phone_no":"555-0100"}`, token)
+	if status != fiber.StatusOK {
+		t.Fatalf("update user: status %d: %s", status, body)
+	}
+	status, body = call(t, app, fiber.MethodGet, routes.Prefix+"/audit-logs", "", token)
+	if status != fiber.StatusOK {
+		t.Fatalf("list audit logs: status %d: %s", status, body)
+	}
+	// The states are rendered as JSON objects holding the changed fields, not as strings.
+	var page struct {
+		Data []struct {
+			Action string                 `json:"action"`
+			Before map[string]interface{} `json:"before"`
+			After  map[string]interface{} `json:"after"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &page); err != nil {
+		t.Fatalf("%v: %s", err, body)
+	}
+	if len(page.Data) != 1 || page.Data[0].Action != "users.update" {
+		t.Fatalf("entries = %s, want one users.update", body)
+	}
+	entry := page.Data[0]
+	if entry.Before["phone_no"] != "" || entry.After["phone_no"] != "555-0100" {
+		t.Errorf("phone_no changed from %v to %v, want from \"\" to 555-0100", entry.Before["phone_no"], entry.After["phone_no"])
+	}
+	if _, ok := entry.After["email"]; ok {
+		t.Errorf("after holds the unchanged email: %v", entry.After)
+	}
+}
+
+// createRole stores a role with the given seeded permissions, by name, and returns its name.
+func createRole(t *testing.T, name string, permissions ...string) string {
+	t.Helper()
+	role := models.Role{Name: name}
+	if err := db.Session().Where("name IN ?", permissions).Find(&role.Permissions).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(role.Permissions) != len(permissions) {
+		t.Fatalf("permissions %v are not all seeded", permissions)
+	}
+	if err := db.Session().Create(&role).Error; err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestPermissionRoutes(t *testing.T) {
+	paths := []string{"/permissions", "/permissions/matrix", "/permissions/1"}
+	tests := []struct {
+		name        string
+		permissions []string
+		// status is the expected status of every path.
+		status []int
+	}{
+		{name: "roles:read", permissions: []string{"roles:read"}, status: []int{fiber.StatusForbidden, fiber.StatusForbidden, fiber.StatusForbidden}},
+		{name: "permissions:list", permissions: []string{"permissions:list"}, status: []int{fiber.StatusOK, fiber.StatusOK, fiber.StatusForbidden}},
+		{name: "permissions:read", permissions: []string{"permissions:read"}, status: []int{fiber.StatusForbidden, fiber.StatusForbidden, fiber.StatusOK}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := setup(t)
+			token, _ := register(t, app, "ada@example.com", createRole(t, "Editor", test.permissions...))
+			for i, path := range paths {
+				if status, body := call(t, app, fiber.MethodGet, routes.Prefix+path, "", token); status != test.status[i] {
+					t.Errorf("%s: status %d, want %d: %s", path, status, test.status[i], body)
+				}
+			}
+		})
+	}
+}
+
+func TestPermissionMatrix(t *testing.T) {
+	tests := []struct {
+		name string
+		// custom are permissions created by users besides the seeded ones.
+		custom  []models.Permission
+		actions []string
+	}{
+		{name: "seeded permissions", actions: []string{"list", "read", "create", "update", "delete", "export", "*"}},
+		{
+			name:    "custom permission for another action",
+			custom:  []models.Permission{{Name: "orders:approve", Resource: "orders", Action: "approve", Category: "Sales"}},
+			actions: []string{"list", "read", "create", "update", "delete", "export", "approve", "*"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := setup(t)
+			token, _ := register(t, app, "ada@example.com", "Admin")
+			if len(test.custom) > 0 {
+				if err := db.Session().Create(&test.custom).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			status, body := call(t, app, fiber.MethodGet, routes.Prefix+"/permissions/matrix", "", token)
+			if status != fiber.StatusOK {
+				t.Fatalf("status %d: %s", status, body)
+			}
+			var matrix struct {
+				Actions []string `json:"actions"`
+			}
+			if err := json.Unmarshal(body, &matrix); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(matrix.Actions, test.actions) {
+				t.Errorf("actions = %v, want %v", matrix.Actions, test.actions)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package routes_test
+
+import (
+	"testing"
+
+	"github.com/lemadane/admin_backend_gofiber/db"
+	"github.com/lemadane/admin_backend_gofiber/models"
+	"github.com/lemadane/admin_backend_gofiber/routes"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestLookups(t *testing.T) {
+	// Each test starts with Ada, who holds the admin role, and Bob, whose IDs are 1 and 2.
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		// ifMatch is the If-Match header: "current" sends the ETag returned by GET on the path.
+		ifMatch string
+		status  int
+	}{
+		{name: "get user", method: fiber.MethodGet, path: "/users/2", status: fiber.StatusOK},
+		{name: "get malformed user", method: fiber.MethodGet, path: "/users/abc", status: fiber.StatusBadRequest},
+		{name: "get user zero", method: fiber.MethodGet, path: "/users/0", status: fiber.StatusBadRequest},
+		{name: "get missing user", method: fiber.MethodGet, path: "/users/999", status: fiber.StatusNotFound},
+		{name: "update malformed user", method: fiber.MethodPut, path: "/users/abc", body: `{"phone_no":"555-0100"}`, status: fiber.StatusBadRequest},
+		{name: "update missing user", method: fiber.MethodPut, path: "/users/999", body: `{"phone_no":"555-0100"}`, status: fiber.StatusNotFound},
+		{name: "delete malformed user", method: fiber.MethodDelete, path: "/users/abc", status: fiber.StatusBadRequest},
+		{name: "delete missing user", method: fiber.MethodDelete, path: "/users/999", status: fiber.StatusNotFound},
+		{name: "get missing role", method: fiber.MethodGet, path: "/roles/999", status: fiber.StatusNotFound},
+		{name: "update malformed role", method: fiber.MethodPut, path: "/roles/abc", body: `{"name":"Clerk","permissions":[]}`, status: fiber.StatusBadRequest},
+		{name: "delete missing role", method: fiber.MethodDelete, path: "/roles/999", status: fiber.StatusNotFound},
+		{name: "update with current If-Match", method: fiber.MethodPut, path: "/users/2", body: `{"phone_no":"555-0100"}`, ifMatch: "current", status: fiber.StatusOK},
+		{name: "update with any If-Match", method: fiber.MethodPut, path: "/users/2", body: `{"phone_no":"555-0100"}`, ifMatch: "*", status: fiber.StatusOK},
+		{name: "update with stale If-Match", method: fiber.MethodPut, path: "/users/2", body: `{"phone_no":"555-0100"}`, ifMatch: `W/"stale"`, status: fiber.StatusPreconditionFailed},
+		{name: "update without If-Match", method: fiber.MethodPut, path: "/users/2", body: `{"phone_no":"555-0100"}`, status: fiber.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := setup(t)
+			token, _ := register(t, app, "ada@example.com", "Admin")
+			register(t, app, "bob@example.com")
+
+			headers := map[string]string{}
+			if test.ifMatch == "current" {
+				_, header, body := send(t, app, fiber.MethodGet, routes.Prefix+test.path, "", token, nil)
+				if header.Get(fiber.HeaderETag) == "" {
+					t.Fatalf("get: no ETag: %s", body)
+				}
+				headers[fiber.HeaderIfMatch] = header.Get(fiber.HeaderETag)
+			} else if test.ifMatch != "" {
+				headers[fiber.HeaderIfMatch] = test.ifMatch
+			}
+			status, _, body := send(t, app, test.method, routes.Prefix+test.path, test.body, token, headers)
+			if status != test.status {
+				t.Fatalf("status %d, want %d: %s", status, test.status, body)
+			}
+			if test.status != fiber.StatusPreconditionFailed {
+				return
+			}
+			// A rejected update changes nothing.
+			var bob models.User
+			if err := db.Session().First(&bob, 2).Error; err != nil {
+				t.Fatal(err)
+			}
+			if bob.PhoneNo != "" {
+				t.Errorf("phone_no = %q after a rejected update, want it unchanged", bob.PhoneNo)
+			}
+		})
+	}
+}
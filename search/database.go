@@ -0,0 +1,84 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lemadane/admin_backend_gofiber/models"
+	"github.com/lemadane/admin_backend_gofiber/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Database is the Backend that queries the columns of the searchable fields. It always sees the current
+// data, and the indexes it uses are maintained by the database itself.
+//
+// On MySQL and PostgreSQL it uses the full-text indexes added by migration 14: MATCH ... AGAINST in
+// boolean mode on MySQL, and to_tsvector and to_tsquery on PostgreSQL. Like the Memory backend, these
+// only find terms at the start of a word, where words are separated by any character other than a
+// letter or a digit: "acme" finds "ada@acme.com", but "cme" does not. A term holding no word, and on
+// MySQL a term holding a word shorter than minFulltextWord, which MySQL does not index, is matched
+// with LIKE instead, which finds it anywhere in a value but scans the table. MySQL also ignores the
+// words of its stopword list, such as "com"; the matches are ranked against the whole term anyway,
+// which leaves out those that do not contain it. On SQLite, every term is matched with LIKE.
+type Database struct{}
+
+// minFulltextWord is the length of the shortest word that MySQL indexes, its default
+// innodb_ft_min_token_size.
+const minFulltextWord = 3
+
+// Search implements Backend. Matching ignores case; the matches are loaded, the most recent first, and
+// ranked in memory.
+func (Database) Search(db *gorm.DB, kind *Kind, terms []string, scope models.Scope) ([]Result, error) {
+	query := db.Order(clause.OrderByColumn{Column: clause.Column{Table: clause.CurrentTable, Name: "id"}, Desc: true})
+	for _, term := range terms {
+		query = query.Where(termCondition(db.Dialector.Name(), kind, term))
+	}
+	documents, err := kind.load(query, scope, MaxMatches)
+	if err != nil {
+		return nil, err
+	}
+	return rank(kind, documents, terms), nil
+}
+
+// termCondition returns the condition that selects the entities of kind with a field matching term, in
+// the SQL of the named dialect.
+func termCondition(dialect string, kind *Kind, term string) clause.Expression {
+	condition, value := termMatch(dialect, term)
+	filterFields := kind.Entity.FilterFields()
+	alternatives := make([]clause.Expression, len(kind.Fields))
+	for i, field := range kind.Fields {
+		filterField := filterFields[field.Name]
+		sql := fmt.Sprintf(condition, filterField.Column)
+		if filterField.Subquery != "" {
+			sql = fmt.Sprintf(filterField.Subquery, sql)
+		}
+		alternatives[i] = clause.Expr{SQL: sql, Vars: []interface{}{value}}
+	}
+	return models.AnyOf(alternatives)
+}
+
+// termMatch returns the condition that matches term in a column, with a %s verb for the column and a
+// placeholder for the returned value. Every word of the term has to start a word of the column.
+func termMatch(dialect string, term string) (string, string) {
+	termWords := words(term)
+	fulltext := len(termWords) > 0
+	for _, word := range termWords {
+		if dialect == "mysql" && utf8.RuneCountInString(word) < minFulltextWord {
+			fulltext = false
+		}
+	}
+	if fulltext {
+		switch dialect {
+		case "mysql":
+			return "MATCH (%s) AGAINST (? IN BOOLEAN MODE)", "+" + strings.Join(termWords, "* +") + "*"
+		case "postgres":
+			// The expression is that of the indexes of migration 14, so that they are used.
+			return "to_tsvector('simple', regexp_replace(%s, '[^[:alnum:]]+', ' ', 'g')) @@ to_tsquery('simple', ?)",
+				strings.Join(termWords, ":* & ") + ":*"
+		}
+	}
+	return "LOWER(%s) LIKE ? ESCAPE '!'", utils.ContainsPattern(term)
+}
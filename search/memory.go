@@ -0,0 +1,232 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lemadane/admin_backend_gofiber/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IndexTTL bounds how long the Memory backend uses an index before rebuilding it from the database.
+// Writes made through a database watched with Watch drop the index at once; the TTL only matters for
+// writes made by other instances or with raw SQL, and for an index rebuilt while a write was not yet
+// committed.
+const IndexTTL = time.Minute
+
+// candidateBatch is the number of candidates whose entities the Memory backend loads with one query.
+const candidateBatch = 500
+
+// Memory is the Backend that keeps an inverted index of the words of the searchable fields in memory,
+// so that finding the entities that match does not scan the database. The database is only queried
+// for the candidates found in the index, to apply the scope of the caller and to rank their current
+// values. The index of a kind is built on its first search and rebuilt once it is older than IndexTTL
+// or one of the kind's tables was written to.
+//
+// Unlike the Database backend, which finds a term anywhere in a value, the index only finds terms at
+// the start of a word: "acme" finds "ada@acme.com", but "cme" does not. Words are separated by any
+// character other than a letter or a digit, so a term such as "acme.com" finds the values in which a
+// word starting with "acme" is followed by ".com"; a term holding no letter or digit finds nothing.
+type Memory struct {
+	mu      sync.Mutex
+	indexes map[string]*index
+	// builds holds the builds in progress by kind, so that concurrent searches wait for one build
+	// instead of each building the index.
+	builds map[string]*build
+	// generations counts the invalidations of each kind, so that an index built while one of the kind's
+	// tables was written to is not kept.
+	generations map[string]uint64
+}
+
+// build is a build of an index in progress. Its index and err are set before done is closed.
+type build struct {
+	done  chan struct{}
+	index *index
+	err   error
+}
+
+// index maps the words of the searchable fields of every entity of a kind to the entities holding them.
+type index struct {
+	builtAt time.Time
+	// words are the indexed words, sorted so that those starting with a term are adjacent.
+	words []string
+	// postings holds the IDs of the entities holding each word.
+	postings map[string][]uint
+}
+
+// NewMemory returns a Memory backend with empty indexes.
+func NewMemory() *Memory {
+	return &Memory{indexes: map[string]*index{}, builds: map[string]*build{}, generations: map[string]uint64{}}
+}
+
+// Search implements Backend. The candidates found in the index are loaded with the scope, the most
+// recent first, and ranked on their current values, so that those that no longer match are left out.
+func (memory *Memory) Search(db *gorm.DB, kind *Kind, terms []string, scope models.Scope) ([]Result, error) {
+	index, err := memory.index(db, kind)
+	if err != nil {
+		return nil, err
+	}
+	candidates := index.lookup(terms)
+	documents := make([]Document, 0)
+	for start := 0; start < len(candidates) && len(documents) < MaxMatches; start += candidateBatch {
+		batch := candidates[start:min(start+candidateBatch, len(candidates))]
+		ids := make([]interface{}, len(batch))
+		for i, id := range batch {
+			ids[i] = id
+		}
+		query := db.Where(clause.IN{Column: clause.Column{Table: clause.CurrentTable, Name: "id"}, Values: ids}).
+			Order(clause.OrderByColumn{Column: clause.Column{Table: clause.CurrentTable, Name: "id"}, Desc: true})
+		loaded, err := kind.load(query, scope, MaxMatches-len(documents))
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, loaded...)
+	}
+	return rank(kind, documents, terms), nil
+}
+
+// index returns the index of kind, building it if it is missing or expired.
+// The index is built without holding the lock, so that searches of other kinds and invalidations do not
+// wait for it, and swapped in once it is complete. Searches of the same kind wait for the build in
+// progress instead of starting another one.
+func (memory *Memory) index(db *gorm.DB, kind *Kind) (*index, error) {
+	memory.mu.Lock()
+	cached, ok := memory.indexes[kind.Type]
+	if ok && time.Since(cached.builtAt) < IndexTTL {
+		memory.mu.Unlock()
+		return cached, nil
+	}
+	if pending, ok := memory.builds[kind.Type]; ok {
+		memory.mu.Unlock()
+		<-pending.done
+		return pending.index, pending.err
+	}
+	pending := &build{done: make(chan struct{})}
+	memory.builds[kind.Type] = pending
+	generation := memory.generations[kind.Type]
+	memory.mu.Unlock()
+
+	pending.index, pending.err = buildIndex(db, kind)
+
+	memory.mu.Lock()
+	if memory.builds[kind.Type] == pending {
+		delete(memory.builds, kind.Type)
+	}
+	if pending.err == nil && memory.generations[kind.Type] == generation {
+		memory.indexes[kind.Type] = pending.index
+	}
+	memory.mu.Unlock()
+	close(pending.done)
+	return pending.index, pending.err
+}
+
+// buildIndex builds the index of kind from the database.
+func buildIndex(db *gorm.DB, kind *Kind) (*index, error) {
+	builtAt := time.Now()
+	documents, err := kind.load(db, models.Unrestricted, -1)
+	if err != nil {
+		return nil, err
+	}
+	built := &index{builtAt: builtAt, postings: map[string][]uint{}}
+	for _, document := range documents {
+		held := map[string]bool{}
+		for _, field := range kind.Fields {
+			for _, value := range document.Values[field.Name] {
+				for _, word := range words(value) {
+					held[word] = true
+				}
+			}
+		}
+		for word := range held {
+			built.postings[word] = append(built.postings[word], document.Id)
+		}
+	}
+	built.words = make([]string, 0, len(built.postings))
+	for word := range built.postings {
+		built.words = append(built.words, word)
+	}
+	sort.Strings(built.words)
+	return built, nil
+}
+
+// invalidate drops the indexes of the kinds stored in table, so that the next search rebuilds them.
+// The builds in progress may miss the write, so their indexes are not kept, and the next search starts
+// a build of its own.
+func (memory *Memory) invalidate(table string) {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+	for _, kind := range Kinds {
+		for _, kindTable := range kind.Tables {
+			if kindTable == table {
+				delete(memory.indexes, kind.Type)
+				delete(memory.builds, kind.Type)
+				memory.generations[kind.Type]++
+			}
+		}
+	}
+}
+
+// lookup returns the IDs of the entities that hold, for every word of every term, a word starting with
+// it, the most recent first.
+func (index *index) lookup(terms []string) []uint {
+	var found map[uint]bool
+	for _, term := range terms {
+		termWords := words(term)
+		if len(termWords) == 0 {
+			return nil
+		}
+		for _, termWord := range termWords {
+			holding := map[uint]bool{}
+			for i := sort.SearchStrings(index.words, termWord); i < len(index.words) && strings.HasPrefix(index.words[i], termWord); i++ {
+				for _, id := range index.postings[index.words[i]] {
+					if found == nil || found[id] {
+						holding[id] = true
+					}
+				}
+			}
+			found = holding
+			if len(found) == 0 {
+				return nil
+			}
+		}
+	}
+	ids := make([]uint, 0, len(found))
+	for id := range found {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] > ids[j] })
+	return ids
+}
+
+// words splits a value into its lowercase words.
+func words(value string) []string {
+	return strings.FieldsFunc(strings.ToLower(value), func(r rune) bool { return !isWordRune(r) })
+}
+
+// Watch makes db drop the indexes of the Memory backend whose tables it writes to, so that searches see
+// the changes made through this process at once. It registers callbacks on db and must be called
+// before db is used concurrently.
+func Watch(db *gorm.DB) error {
+	invalidate := func(tx *gorm.DB) {
+		if tx.Error != nil || tx.Statement.Table == "" {
+			return
+		}
+		for _, backend := range backends {
+			if memory, ok := backend.(*Memory); ok {
+				memory.invalidate(tx.Statement.Table)
+			}
+		}
+	}
+	callbacks := db.Callback()
+	if err := callbacks.Create().After("gorm:create").Register("search:invalidate", invalidate); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Register("search:invalidate", invalidate); err != nil {
+		return err
+	}
+	return callbacks.Delete().After("gorm:delete").Register("search:invalidate", invalidate)
+}
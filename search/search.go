@@ -0,0 +1,240 @@
+package search
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/lemadane/admin_backend_gofiber/config"
+	"github.com/lemadane/admin_backend_gofiber/models"
+	"github.com/lemadane/admin_backend_gofiber/repositories"
+
+	"gorm.io/gorm"
+)
+
+// MaxMatches is the largest number of matches of one type that a search ranks. When more entities match,
+// the backends rank the most recent ones.
+const MaxMatches = 500
+
+// Result is an entity found by a search.
+type Result struct {
+	Type     string `json:"type"`
+	Id       uint   `json:"id"`
+	Title    string `json:"title"`
+	Subtitle string `json:"subtitle"`
+	// Matches names the fields that contain a search term, e.g. "email".
+	Matches []string `json:"matches"`
+	// Score ranks the results: the higher, the better the entity matches.
+	Score float64 `json:"score"`
+}
+
+// Backend finds the entities of a Kind that match search terms.
+type Backend interface {
+	// Search returns the entities of kind visible through scope that contain every term in one of the
+	// kind's fields, ranked best first. It returns at most MaxMatches results.
+	Search(db *gorm.DB, kind *Kind, terms []string, scope models.Scope) ([]Result, error)
+}
+
+// Field is a searchable field of a Kind.
+type Field struct {
+	// Name is the name of the field among the FilterFields of the entity, e.g. "email".
+	Name string
+	// Weight is how much a match in this field counts towards the score.
+	Weight float64
+}
+
+// Document holds the searchable values of an entity.
+type Document struct {
+	Id       uint
+	Title    string
+	Subtitle string
+	// Values holds the values of each Field by name. Fields of related rows, such as the product titles
+	// of the items of an order, may hold several.
+	Values map[string][]string
+}
+
+// Kind describes a type of entity that can be searched.
+type Kind struct {
+	// Type is the name of the type in the results, which is also the resource whose list permission is
+	// required to search it.
+	Type   string
+	Fields []Field
+	// Entity describes the fields, whose columns the database backend matches.
+	Entity models.Entity
+	// Tables are the tables holding the fields, whose writes make the memory backend rebuild its index.
+	Tables []string
+	// load returns the documents of the entities visible through scope, at most limit unless negative.
+	load func(db *gorm.DB, scope models.Scope, limit int) ([]Document, error)
+}
+
+// Kinds are the types of entities that can be searched, in the order their results are grouped.
+var Kinds = []*Kind{
+	newKind("users", repositories.Users, []string{"users"}, []Field{
+		{Name: "email", Weight: 3},
+		{Name: "firstname", Weight: 2},
+		{Name: "lastname", Weight: 2},
+		{Name: "phone_no", Weight: 1},
+	}, func(user models.User) Document {
+		return Document{
+			Id:       user.Id,
+			Title:    strings.TrimSpace(user.Firstname + " " + user.Lastname),
+			Subtitle: user.Email,
+			Values: map[string][]string{
+				"email":     {user.Email},
+				"firstname": {user.Firstname},
+				"lastname":  {user.Lastname},
+				"phone_no":  {user.PhoneNo},
+			},
+		}
+	}),
+	newKind("orders", repositories.Orders, []string{"orders", "order_items"}, []Field{
+		{Name: "email", Weight: 3},
+		{Name: "firstname", Weight: 2},
+		{Name: "lastname", Weight: 2},
+		{Name: "product_title", Weight: 1},
+	}, func(order models.Order) Document {
+		titles := make([]string, len(order.OrderItems))
+		for i, item := range order.OrderItems {
+			titles[i] = item.ProductTitle
+		}
+		return Document{
+			Id:       order.Id,
+			Title:    fmt.Sprintf("Order #%d", order.Id),
+			Subtitle: strings.TrimSpace(order.Name + " <" + order.Email + ">"),
+			Values: map[string][]string{
+				"email":         {order.Email},
+				"firstname":     {order.Firstname},
+				"lastname":      {order.Lastname},
+				"product_title": titles,
+			},
+		}
+	}),
+}
+
+// newKind returns the Kind of the entities of a repository, described by document.
+func newKind[T any](name string, repository *repositories.Repository[T], tables []string, fields []Field, document func(T) Document) *Kind {
+	return &Kind{
+		Type:   name,
+		Fields: fields,
+		Entity: repository.Entity(),
+		Tables: tables,
+		load: func(db *gorm.DB, scope models.Scope, limit int) ([]Document, error) {
+			entities, err := repository.List(db, scope, limit, -1)
+			if err != nil {
+				return nil, err
+			}
+			documents := make([]Document, len(entities))
+			for i, entity := range entities {
+				documents[i] = document(entity)
+			}
+			return documents, nil
+		},
+	}
+}
+
+// backends are the available backends by the name that selects them in the configuration.
+var backends = map[string]Backend{
+	"database": Database{},
+	"memory":   NewMemory(),
+}
+
+// Current returns the backend selected by the configuration.
+func Current() Backend {
+	if backend, ok := backends[config.Get().Search.Backend]; ok {
+		return backend
+	}
+	return backends["database"]
+}
+
+// Terms splits a query into the lowercase terms that a search matches, which are separated by spaces.
+func Terms(query string) []string {
+	return strings.Fields(strings.ToLower(query))
+}
+
+// rank scores the documents of kind against the terms and returns those that contain every term,
+// the best first and, among equal scores, the most recent first.
+// A term counts the weight of the field it is found in, four times if it is the whole value and twice if it
+// starts a word of it; where a term is found in several fields, the best of them counts.
+func rank(kind *Kind, documents []Document, terms []string) []Result {
+	results := make([]Result, 0)
+	for _, document := range documents {
+		var score float64
+		matched := map[string]bool{}
+		for _, term := range terms {
+			var best float64
+			for _, field := range kind.Fields {
+				for _, value := range document.Values[field.Name] {
+					points := match(strings.ToLower(value), term) * field.Weight
+					if points > 0 {
+						matched[field.Name] = true
+					}
+					if points > best {
+						best = points
+					}
+				}
+			}
+			if best == 0 {
+				score = 0
+				break
+			}
+			score += best
+		}
+		if score == 0 {
+			continue
+		}
+		fields := make([]string, 0, len(matched))
+		for _, field := range kind.Fields {
+			if matched[field.Name] {
+				fields = append(fields, field.Name)
+			}
+		}
+		results = append(results, Result{
+			Type:     kind.Type,
+			Id:       document.Id,
+			Title:    document.Title,
+			Subtitle: document.Subtitle,
+			Matches:  fields,
+			Score:    score,
+		})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Id > results[j].Id
+	})
+	return results
+}
+
+// match returns how well a lowercase value matches a term: 4 if it equals the term, 2 if a word of it
+// starts with the term, 1 if it otherwise contains the term and 0 if it does not.
+func match(value string, term string) float64 {
+	if value == term {
+		return 4
+	}
+	found := false
+	for offset := 0; ; {
+		index := strings.Index(value[offset:], term)
+		if index < 0 {
+			break
+		}
+		found = true
+		index += offset
+		if previous, _ := utf8.DecodeLastRuneInString(value[:index]); index == 0 || !isWordRune(previous) {
+			return 2
+		}
+		offset = index + 1
+	}
+	if found {
+		return 1
+	}
+	return 0
+}
+
+// isWordRune reports whether r belongs to a word, as opposed to separating words like spaces and the
+// punctuation of email addresses and phone numbers.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
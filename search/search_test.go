@@ -0,0 +1,232 @@
+package search
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/lemadane/admin_backend_gofiber/db"
+	"github.com/lemadane/admin_backend_gofiber/internal/testdb"
+	"github.com/lemadane/admin_backend_gofiber/models"
+
+	"gorm.io/gorm"
+)
+
+// setupDB connects to a test database holding the given users and orders.
+func setupDB(t *testing.T, users []models.User, orders []models.Order) {
+	t.Helper()
+	testdb.Setup(t)
+	if err := db.Session().Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) > 0 {
+		if err := db.Session().Create(&orders).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// ids returns the IDs of the results, in order.
+func ids(results []Result) []uint {
+	found := make([]uint, len(results))
+	for i, result := range results {
+		found[i] = result.Id
+	}
+	return found
+}
+
+func TestBackends(t *testing.T) {
+	users := []models.User{
+		{Firstname: "Ada", Lastname: "Lovelace", Email: "ada@acme.com", PhoneNo: "+44 20 7946 0001"},
+		{Firstname: "Adam", Lastname: "Smith", Email: "adam@example.com", PhoneNo: "555-0100"},
+		{Firstname: "Grace", Lastname: "Hopper", Email: "grace@acme.com", PhoneNo: "555-0199"},
+	}
+	orders := []models.Order{
+		{Firstname: "Ada", Email: "ada@acme.com", OrderItems: []models.OrderItem{{ProductTitle: "Analytical Engine"}}},
+		{Firstname: "Bob", Email: "bob@example.com", OrderItems: []models.OrderItem{{ProductTitle: "Difference Engine"}, {ProductTitle: "Punched cards"}}},
+	}
+
+	tests := []struct {
+		name  string
+		kind  int
+		query string
+		// database and memory are the IDs of the results of each backend, best first.
+		database []uint
+		memory   []uint
+	}{
+		{name: "whole value first", kind: 0, query: "ada", database: []uint{1, 2}, memory: []uint{1, 2}},
+		{name: "every term", kind: 0, query: "ada lovelace", database: []uint{1}, memory: []uint{1}},
+		{name: "term with separators", kind: 0, query: "acme.com", database: []uint{3, 1}, memory: []uint{3, 1}},
+		{name: "phone number", kind: 0, query: "555-01", database: []uint{3, 2}, memory: []uint{3, 2}},
+		{name: "part of a phone number word", kind: 0, query: "0199", database: []uint{3}, memory: []uint{3}},
+		{name: "inside a word", kind: 0, query: "cme", database: []uint{3, 1}, memory: []uint{}},
+		{name: "no letters or digits", kind: 0, query: "@", database: []uint{3, 2, 1}, memory: []uint{}},
+		{name: "no match", kind: 0, query: "turing", database: []uint{}, memory: []uint{}},
+		{name: "related rows", kind: 1, query: "engine", database: []uint{2, 1}, memory: []uint{2, 1}},
+		{name: "related and own fields", kind: 1, query: "ada engine", database: []uint{1}, memory: []uint{1}},
+	}
+	setupDB(t, users, orders)
+	memory := NewMemory()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kind := Kinds[test.kind]
+			for _, backend := range []struct {
+				name    string
+				backend Backend
+				want    []uint
+			}{
+				{"database", Database{}, test.database},
+				{"memory", memory, test.memory},
+			} {
+				results, err := backend.backend.Search(db.Session(), kind, Terms(test.query), models.Unrestricted)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := ids(results); !reflect.DeepEqual(got, backend.want) {
+					t.Errorf("%s: results = %v, want %v", backend.name, got, backend.want)
+				}
+			}
+		})
+	}
+}
+
+func TestTermMatch(t *testing.T) {
+	tests := []struct {
+		dialect   string
+		term      string
+		condition string
+		value     string
+	}{
+		{"mysql", "acme.com", "MATCH (%s) AGAINST (? IN BOOLEAN MODE)", "+acme* +com*"},
+		{"mysql", "555-0100", "MATCH (%s) AGAINST (? IN BOOLEAN MODE)", "+555* +0100*"},
+		{"mysql", "ada", "MATCH (%s) AGAINST (? IN BOOLEAN MODE)", "+ada*"},
+		{"mysql", "al", "LOWER(%s) LIKE ? ESCAPE '!'", "%al%"},
+		{"mysql", "@", "LOWER(%s) LIKE ? ESCAPE '!'", "%@%"},
+		{"postgres", "acme.com", "to_tsvector('simple', regexp_replace(%s, '[^[:alnum:]]+', ' ', 'g')) @@ to_tsquery('simple', ?)", "acme:* & com:*"},
+		{"postgres", "al", "to_tsvector('simple', regexp_replace(%s, '[^[:alnum:]]+', ' ', 'g')) @@ to_tsquery('simple', ?)", "al:*"},
+		{"postgres", "100%", "to_tsvector('simple', regexp_replace(%s, '[^[:alnum:]]+', ' ', 'g')) @@ to_tsquery('simple', ?)", "100:*"},
+		{"postgres", "@", "LOWER(%s) LIKE ? ESCAPE '!'", "%@%"},
+		{"sqlite", "acme.com", "LOWER(%s) LIKE ? ESCAPE '!'", "%acme.com%"},
+		{"sqlite", "100%", "LOWER(%s) LIKE ? ESCAPE '!'", "%100!%%"},
+	}
+	for _, test := range tests {
+		t.Run(test.dialect+" "+test.term, func(t *testing.T) {
+			condition, value := termMatch(test.dialect, test.term)
+			if condition != test.condition || value != test.value {
+				t.Errorf("termMatch() = %q, %q, want %q, %q", condition, value, test.condition, test.value)
+			}
+		})
+	}
+}
+
+func TestMemoryScope(t *testing.T) {
+	users := []models.User{
+		{Firstname: "Ada", Email: "ada@acme.com", Region: "emea"},
+		{Firstname: "Adam", Email: "adam@acme.com", Region: "apac"},
+	}
+	setupDB(t, users, []models.Order{})
+	scope := func(tx *gorm.DB) *gorm.DB { return tx.Where("users.region = ?", "emea") }
+	results, err := NewMemory().Search(db.Session(), Kinds[0], Terms("acme"), scope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(results); !reflect.DeepEqual(got, []uint{1}) {
+		t.Errorf("results = %v, want [1]", got)
+	}
+}
+
+func TestMemoryConcurrentSearches(t *testing.T) {
+	setupDB(t, []models.User{{Firstname: "Ada", Email: "ada@acme.com"}}, []models.Order{})
+	memory := NewMemory()
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Every other goroutine drops the index, so that searches race with builds and invalidations.
+			if i%2 == 1 {
+				memory.invalidate("users")
+			}
+			results, err := memory.Search(db.Session(), Kinds[0], Terms("acme"), models.Unrestricted)
+			if err == nil && !reflect.DeepEqual(ids(results), []uint{1}) {
+				err = fmt.Errorf("results = %v, want [1]", ids(results))
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	tests := []struct {
+		name string
+		// change writes to the database through tx.
+		change func(tx *gorm.DB) error
+		want   []uint
+	}{
+		{
+			name: "created entity",
+			change: func(tx *gorm.DB) error {
+				return tx.Create(&models.User{Firstname: "Grace", Email: "grace@acme.com"}).Error
+			},
+			want: []uint{2, 1},
+		},
+		{
+			name:   "updated entity",
+			change: func(tx *gorm.DB) error { return tx.Model(&models.User{Id: 1}).Update("email", "ada@example.com").Error },
+			want:   []uint{},
+		},
+		{
+			name:   "deleted entity",
+			change: func(tx *gorm.DB) error { return tx.Delete(&models.User{Id: 1}).Error },
+			want:   []uint{},
+		},
+		{
+			// The user inserted with raw SQL is only found once the index is rebuilt, which writing
+			// to another table does not cause.
+			name: "other table",
+			change: func(tx *gorm.DB) error {
+				if err := tx.Exec("INSERT INTO users (firstname, email) VALUES (?, ?)", "Grace", "grace@acme.com").Error; err != nil {
+					return err
+				}
+				return tx.Create(&models.Order{Email: "grace@acme.com"}).Error
+			},
+			want: []uint{1},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setupDB(t, []models.User{{Firstname: "Ada", Email: "ada@acme.com"}}, []models.Order{})
+			// Every test connects anew, so the callbacks are registered on a database of its own.
+			tx := db.Session()
+			memory := NewMemory()
+			previous := backends["memory"]
+			backends["memory"] = memory
+			t.Cleanup(func() { backends["memory"] = previous })
+			if err := Watch(tx); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := memory.Search(tx, Kinds[0], Terms("acme"), models.Unrestricted); err != nil {
+				t.Fatal(err)
+			}
+			if err := test.change(tx); err != nil {
+				t.Fatal(err)
+			}
+			results, err := memory.Search(tx, Kinds[0], Terms("acme"), models.Unrestricted)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ids(results); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("results = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+// Package ttlmap provides a concurrency-safe map whose entries expire after a fixed time to live.
+package ttlmap
+
+import (
+	"sync"
+	"time"
+)
+
+// Map is a map from K to V whose entries expire once they are older than its TTL. Expired entries are
+// never returned, and are dropped by a sweep that runs at most once per TTL, when an entry is set, so
+// that keys that are no longer used do not accumulate and each Set costs amortized constant time.
+// A Map is safe for concurrent use.
+type Map[K comparable, V any] struct {
+	ttl     time.Duration
+	mu      sync.RWMutex
+	entries map[K]entry[V]
+	sweptAt time.Time
+	now     func() time.Time
+}
+
+// entry is a value with the time it was set.
+type entry[V any] struct {
+	value V
+	setAt time.Time
+}
+
+// New returns an empty Map whose entries expire after ttl.
+func New[K comparable, V any](ttl time.Duration) *Map[K, V] {
+	return &Map[K, V]{ttl: ttl, entries: map[K]entry[V]{}, sweptAt: time.Now(), now: time.Now}
+}
+
+// Get returns the value of key, if it is set and has not expired.
+func (m *Map[K, V]) Get(key K) (V, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	cached, ok := m.entries[key]
+	if !ok || m.now().Sub(cached.setAt) >= m.ttl {
+		var zero V
+		return zero, false
+	}
+	return cached.value, true
+}
+
+// Set sets the value of key, which expires after the TTL of the map.
+func (m *Map[K, V]) Set(key K, value V) {
+	now := m.now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now.Sub(m.sweptAt) >= m.ttl {
+		for key, cached := range m.entries {
+			if now.Sub(cached.setAt) >= m.ttl {
+				delete(m.entries, key)
+			}
+		}
+		m.sweptAt = now
+	}
+	m.entries[key] = entry[V]{value: value, setAt: now}
+}
+
+// Delete removes the given keys.
+func (m *Map[K, V]) Delete(keys ...K) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		delete(m.entries, key)
+	}
+}
+
+// Clear removes every key.
+func (m *Map[K, V]) Clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = map[K]entry[V]{}
+}
+
+// Len returns the number of entries held, including those that expired but were not swept yet.
+func (m *Map[K, V]) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.entries)
+}
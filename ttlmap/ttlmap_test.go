@@ -0,0 +1,55 @@
+package ttlmap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMap(t *testing.T) {
+	start := time.Now()
+	now := start
+	m := New[string, int](time.Minute)
+	m.now = func() time.Time { return now }
+	m.sweptAt = start
+
+	m.Set("a", 1)
+	if got, ok := m.Get("a"); !ok || got != 1 {
+		t.Fatalf("Get(a) = %d, %v, want 1, true", got, ok)
+	}
+	if _, ok := m.Get("b"); ok {
+		t.Fatal("Get(b) found a key that was never set")
+	}
+
+	now = start.Add(30 * time.Second)
+	m.Set("b", 2)
+	now = start.Add(time.Minute)
+	if _, ok := m.Get("a"); ok {
+		t.Error("Get(a) found an expired entry")
+	}
+	if got, ok := m.Get("b"); !ok || got != 2 {
+		t.Errorf("Get(b) = %d, %v, want 2, true", got, ok)
+	}
+	// The expired entry is only dropped by the sweep of the next Set.
+	if got := m.Len(); got != 2 {
+		t.Errorf("Len() before the sweep = %d, want 2", got)
+	}
+	m.Set("c", 3)
+	if got := m.Len(); got != 2 {
+		t.Errorf("Len() after the sweep = %d, want 2", got)
+	}
+	// No sweep runs again before another TTL has passed.
+	now = start.Add(100 * time.Second)
+	m.Set("d", 4)
+	if got := m.Len(); got != 3 {
+		t.Errorf("Len() between sweeps = %d, want 3", got)
+	}
+
+	m.Delete("c", "d")
+	if _, ok := m.Get("c"); ok {
+		t.Error("Get(c) found a deleted entry")
+	}
+	m.Clear()
+	if got := m.Len(); got != 0 {
+		t.Errorf("Len() after Clear = %d, want 0", got)
+	}
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/lemadane/admin_backend_gofiber/apierror"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ETag returns a weak entity tag for the JSON representation of v.
+// The same representation always yields the same tag, so it changes whenever
+// a field that clients can see changes.
+func ETag(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// SetETag computes the entity tag of v and sets it as the ETag response header.
+func SetETag(c *fiber.Ctx, v interface{}) error {
+	etag, err := ETag(v)
+	if err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderETag, etag)
+	return nil
+}
+
+// CheckIfMatch guards an update against stale representations.
+// If the request carries an If-Match header that matches neither "*" nor the entity tag
+// of current, it returns a 412 API error. Requests without If-Match are allowed through.
+func CheckIfMatch(c *fiber.Ctx, current interface{}) error {
+	header := c.Get(fiber.HeaderIfMatch)
+	if header == "" {
+		return nil
+	}
+	etag, err := ETag(current)
+	if err != nil {
+		return err
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return nil
+		}
+	}
+	return apierror.PreconditionFailed("the resource has been modified since it was retrieved")
+}
@@ -0,0 +1,191 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lemadane/admin_backend_gofiber/apierror"
+	"github.com/lemadane/admin_backend_gofiber/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// filterParam matches the name of a filter query parameter: filter[field] or filter[field][operator].
+var filterParam = regexp.MustCompile(`^filter\[([a-z_]+)\](?:\[([a-z]+)\])?$`)
+
+// filterOperators are the SQL comparison operators of the filter operators, other than like and in.
+var filterOperators = map[string]string{
+	"eq":  "=",
+	"ne":  "<>",
+	"lt":  "<",
+	"lte": "<=",
+	"gt":  ">",
+	"gte": ">=",
+}
+
+// kindOperators lists the operators that apply to each kind of field.
+var kindOperators = map[models.FilterKind][]string{
+	models.FilterString: {"eq", "ne", "like", "in"},
+	models.FilterNumber: {"eq", "ne", "lt", "lte", "gt", "gte", "in"},
+	models.FilterTime:   {"lt", "lte", "gt", "gte"},
+}
+
+// dateLayout is the layout of date-only time filter values.
+const dateLayout = "2006-01-02"
+
+// Filter returns the scope that restricts a query on entity to the records matching the filter query
+// parameters of the request, which take the form filter[field][operator]=value, e.g.
+//
+//	filter[email][like]=@acme.com
+//	filter[created_at][gte]=2024-01-01
+//	filter[role_id][in]=2,3
+//
+// Fields must be among the entity's FilterFields. The operators are eq, which is the default when the
+// operator is omitted as in filter[region]=emea, ne, lt, lte, gt and gte, like, which matches values
+// containing the given text, and in, which takes a comma-separated list. Which operators apply depends
+// on the kind of the field: text fields are compared for (in)equality or containment, numbers also by
+// order, and times only by order. Times are dates or RFC 3339 timestamps; a date stands for the whole
+// day, so that filter[created_at][lte]=2024-01-31 includes records from that day.
+// Every filter must match. It returns a 422 API error naming each invalid filter parameter.
+func Filter(context *fiber.Ctx, entity models.Entity) (models.Scope, error) {
+	fields := entity.FilterFields()
+	conditions := map[string]clause.Expression{}
+	errs := map[string]string{}
+	context.Request().URI().QueryArgs().VisitAll(func(key []byte, value []byte) {
+		param := string(key)
+		if !strings.HasPrefix(param, "filter[") {
+			return
+		}
+		match := filterParam.FindStringSubmatch(param)
+		if match == nil {
+			errs[param] = "must be of the form filter[field][operator]"
+			return
+		}
+		field, ok := fields[match[1]]
+		if !ok {
+			errs[param] = fmt.Sprintf("cannot filter by %q; allowed are %s", match[1], strings.Join(filterNames(fields), ", "))
+			return
+		}
+		operator := match[2]
+		if operator == "" {
+			operator = "eq"
+		}
+		condition, err := filterCondition(field, operator, string(value))
+		if err != nil {
+			errs[param] = err.Error()
+			return
+		}
+		conditions[param] = condition
+	})
+	if len(errs) > 0 {
+		return nil, apierror.Validation(errs)
+	}
+	// Conditions are applied in a fixed order, so that equal filters produce equal queries.
+	params := make([]string, 0, len(conditions))
+	for param := range conditions {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+	return func(db *gorm.DB) *gorm.DB {
+		for _, param := range params {
+			db = db.Where(conditions[param])
+		}
+		return db
+	}, nil
+}
+
+// filterCondition returns the condition of a filter on field with the given operator and value.
+func filterCondition(field models.FilterField, operator string, value string) (clause.Expression, error) {
+	if !hasOperator(field.Kind, operator) {
+		return nil, fmt.Errorf("operator %q does not apply; allowed are %s", operator, strings.Join(kindOperators[field.Kind], ", "))
+	}
+	var sql string
+	var vars []interface{}
+	switch operator {
+	case "like":
+		sql, vars = field.Column+" LIKE ? ESCAPE '!'", []interface{}{ContainsPattern(value)}
+	case "in":
+		values := make([]interface{}, 0)
+		for _, part := range strings.Split(value, ",") {
+			parsed, err := filterValue(field.Kind, part)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, parsed)
+		}
+		sql, vars = field.Column+" IN ?", []interface{}{values}
+	default:
+		parsed, err := filterValue(field.Kind, value)
+		if err != nil {
+			return nil, err
+		}
+		// A date covers the whole day, so comparisons with its end start at the next day.
+		if day, ok := parsed.(time.Time); ok && len(value) == len(dateLayout) {
+			switch operator {
+			case "lte":
+				operator, parsed = "lt", day.AddDate(0, 0, 1)
+			case "gt":
+				operator, parsed = "gte", day.AddDate(0, 0, 1)
+			}
+		}
+		sql, vars = field.Column+" "+filterOperators[operator]+" ?", []interface{}{parsed}
+	}
+	if field.Subquery != "" {
+		sql = fmt.Sprintf(field.Subquery, sql)
+	}
+	return clause.Expr{SQL: sql, Vars: vars}, nil
+}
+
+// ContainsPattern returns the LIKE pattern, to be used with ESCAPE '!', that matches the values containing
+// value. The value is matched literally, so the wildcards of LIKE are escaped.
+func ContainsPattern(value string) string {
+	return "%" + strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(value) + "%"
+}
+
+// filterValue parses a filter value of the given kind.
+func filterValue(kind models.FilterKind, value string) (interface{}, error) {
+	switch kind {
+	case models.FilterNumber:
+		number, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an integer", value)
+		}
+		return number, nil
+	case models.FilterTime:
+		if day, err := time.Parse(dateLayout, value); err == nil {
+			return day, nil
+		}
+		timestamp, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a date such as 2024-01-31 or a timestamp such as 2024-01-31T15:04:05Z", value)
+		}
+		return timestamp, nil
+	}
+	return value, nil
+}
+
+// hasOperator reports whether the operator applies to fields of the kind.
+func hasOperator(kind models.FilterKind, operator string) bool {
+	for _, known := range kindOperators[kind] {
+		if known == operator {
+			return true
+		}
+	}
+	return false
+}
+
+// filterNames returns the names of the filterable fields, sorted.
+func filterNames(fields map[string]models.FilterField) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,226 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/lemadane/admin_backend_gofiber/apierror"
+	"github.com/lemadane/admin_backend_gofiber/db"
+	"github.com/lemadane/admin_backend_gofiber/internal/testdb"
+	"github.com/lemadane/admin_backend_gofiber/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm/clause"
+)
+
+func TestFilterCondition(t *testing.T) {
+	email := models.FilterField{Column: "users.email", Kind: models.FilterString}
+	id := models.FilterField{Column: "users.id", Kind: models.FilterNumber}
+	createdAt := models.FilterField{Column: "orders.created_at", Kind: models.FilterTime}
+	roleId := models.FilterField{
+		Column:   "user_roles.role_id",
+		Kind:     models.FilterNumber,
+		Subquery: "users.id IN (SELECT user_roles.user_id FROM user_roles WHERE %s)",
+	}
+	day := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		field    models.FilterField
+		operator string
+		value    string
+		sql      string
+		vars     []interface{}
+		err      string
+	}{
+		{
+			name: "equal text", field: email, operator: "eq", value: "ada@example.com",
+			sql: "users.email = ?", vars: []interface{}{"ada@example.com"},
+		},
+		{
+			name: "unequal text", field: email, operator: "ne", value: "ada@example.com",
+			sql: "users.email <> ?", vars: []interface{}{"ada@example.com"},
+		},
+		{
+			name: "text containing wildcards", field: email, operator: "like", value: "50%_off!",
+			sql: "users.email LIKE ? ESCAPE '!'", vars: []interface{}{"%50!%!_off!!%"},
+		},
+		{
+			name: "text in a list", field: email, operator: "in", value: "a@example.com,b@example.com",
+			sql: "users.email IN ?", vars: []interface{}{[]interface{}{"a@example.com", "b@example.com"}},
+		},
+		{
+			name: "number less than", field: id, operator: "lt", value: "10",
+			sql: "users.id < ?", vars: []interface{}{int64(10)},
+		},
+		{
+			name: "number in a list", field: id, operator: "in", value: "2,3",
+			sql: "users.id IN ?", vars: []interface{}{[]interface{}{int64(2), int64(3)}},
+		},
+		{
+			name: "number of a related row", field: roleId, operator: "eq", value: "2",
+			sql:  "users.id IN (SELECT user_roles.user_id FROM user_roles WHERE user_roles.role_id = ?)",
+			vars: []interface{}{int64(2)},
+		},
+		{
+			name: "from a date", field: createdAt, operator: "gte", value: "2024-01-31",
+			sql: "orders.created_at >= ?", vars: []interface{}{day},
+		},
+		{
+			name: "before a date", field: createdAt, operator: "lt", value: "2024-01-31",
+			sql: "orders.created_at < ?", vars: []interface{}{day},
+		},
+		{
+			name: "until the end of a date", field: createdAt, operator: "lte", value: "2024-01-31",
+			sql: "orders.created_at < ?", vars: []interface{}{day.AddDate(0, 0, 1)},
+		},
+		{
+			name: "after the end of a date", field: createdAt, operator: "gt", value: "2024-01-31",
+			sql: "orders.created_at >= ?", vars: []interface{}{day.AddDate(0, 0, 1)},
+		},
+		{
+			name: "until a timestamp", field: createdAt, operator: "lte", value: "2024-01-31T15:04:05Z",
+			sql: "orders.created_at <= ?", vars: []interface{}{day.Add(15*time.Hour + 4*time.Minute + 5*time.Second)},
+		},
+		{
+			name: "number that is not an integer", field: id, operator: "eq", value: "1.5",
+			err: `"1.5" is not an integer`,
+		},
+		{
+			name: "list with a number that is not an integer", field: id, operator: "in", value: "1,x",
+			err: `"x" is not an integer`,
+		},
+		{
+			name: "time that is not a date", field: createdAt, operator: "gte", value: "31/01/2024",
+			err: `"31/01/2024" is not a date such as 2024-01-31 or a timestamp such as 2024-01-31T15:04:05Z`,
+		},
+		{
+			name: "order of text", field: email, operator: "lt", value: "b",
+			err: `operator "lt" does not apply; allowed are eq, ne, like, in`,
+		},
+		{
+			name: "equal time", field: createdAt, operator: "eq", value: "2024-01-31",
+			err: `operator "eq" does not apply; allowed are lt, lte, gt, gte`,
+		},
+		{
+			name: "unknown operator", field: id, operator: "between", value: "1",
+			err: `operator "between" does not apply; allowed are eq, ne, lt, lte, gt, gte, in`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			condition, err := filterCondition(test.field, test.operator, test.value)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("filterCondition() error = %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			expr := condition.(clause.Expr)
+			if expr.SQL != test.sql {
+				t.Errorf("SQL = %q, want %q", expr.SQL, test.sql)
+			}
+			if !reflect.DeepEqual(expr.Vars, test.vars) {
+				t.Errorf("vars = %#v, want %#v", expr.Vars, test.vars)
+			}
+		})
+	}
+}
+
+func TestFilter(t *testing.T) {
+	users := []models.User{
+		{Firstname: "Ada", Email: "ada@acme.com", Region: "emea"},
+		{Firstname: "Bob", Email: "bob@acme.com", Region: "apac"},
+		{Firstname: "Cy", Email: "cy@example.com", Region: "emea"},
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		// emails are the emails of the matching users, or fields the parameters of a 422 error.
+		emails []string
+		fields []string
+	}{
+		{name: "no filters", query: "", emails: []string{"ada@acme.com", "bob@acme.com", "cy@example.com"}},
+		{name: "other parameters", query: "page=2&sort=-id", emails: []string{"ada@acme.com", "bob@acme.com", "cy@example.com"}},
+		{name: "default operator", query: "filter[region]=emea", emails: []string{"ada@acme.com", "cy@example.com"}},
+		{name: "explicit operator", query: "filter[region][ne]=emea", emails: []string{"bob@acme.com"}},
+		{name: "containing text", query: "filter[email][like]=@acme.", emails: []string{"ada@acme.com", "bob@acme.com"}},
+		{name: "list", query: "filter[id][in]=1,3", emails: []string{"ada@acme.com", "cy@example.com"}},
+		{
+			name:   "every filter",
+			query:  "filter[region]=emea&filter[email][like]=acme",
+			emails: []string{"ada@acme.com"},
+		},
+		{name: "no match", query: "filter[firstname]=Dee", emails: []string{}},
+		{name: "unknown field", query: "filter[password]=secret", fields: []string{"filter[password]"}},
+		{name: "malformed parameter", query: "filter[email]]=x", fields: []string{"filter[email]]"}},
+		{name: "inapplicable operator", query: "filter[email][gt]=b", fields: []string{"filter[email][gt]"}},
+		{
+			name:   "every invalid parameter",
+			query:  "filter[id]=one&filter[region]=emea&filter[nope]=1",
+			fields: []string{"filter[id]", "filter[nope]"},
+		},
+	}
+
+	testdb.Setup(t)
+	if err := db.Session().Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.Handler})
+	app.Get("/users", func(context *fiber.Ctx) error {
+		filter, err := Filter(context, &models.User{})
+		if err != nil {
+			return err
+		}
+		emails := make([]string, 0)
+		if err := db.Session().Model(&models.User{}).Scopes(filter).Order("email").Pluck("email", &emails).Error; err != nil {
+			return err
+		}
+		return context.JSON(emails)
+	})
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/users?"+test.query, nil), -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer response.Body.Close()
+			if test.fields != nil {
+				if response.StatusCode != fiber.StatusUnprocessableEntity {
+					t.Fatalf("status = %d, want %d", response.StatusCode, fiber.StatusUnprocessableEntity)
+				}
+				var body apierror.Error
+				if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+					t.Fatal(err)
+				}
+				fields := make([]string, 0, len(body.Fields))
+				for field := range body.Fields {
+					fields = append(fields, field)
+				}
+				sort.Strings(fields)
+				if !reflect.DeepEqual(fields, test.fields) {
+					t.Errorf("fields = %q, want %q", fields, test.fields)
+				}
+				return
+			}
+			if response.StatusCode != fiber.StatusOK {
+				t.Fatalf("status = %d, want %d", response.StatusCode, fiber.StatusOK)
+			}
+			var emails []string
+			if err := json.NewDecoder(response.Body).Decode(&emails); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(emails, test.emails) {
+				t.Errorf("emails = %q, want %q", emails, test.emails)
+			}
+		})
+	}
+}
@@ -1,71 +1,98 @@
 package utils
 
 import (
+	"errors"
 	"strconv"
+	"strings"
 	"time"
 
-	"github.com/lemadane/admin_backend_gofiber/db"
-	"github.com/lemadane/admin_backend_gofiber/models"
+	"github.com/lemadane/admin_backend_gofiber/config"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gofiber/fiber/v2"
 )
 
-const SecretKey = "secret"
+// CookieName is the name of the cookie that carries the access token.
+const CookieName = "jwt"
 
-// GenerateJWT generates a JSON Web Token (JWT) with the specified issuer.
-// It returns the generated token as a string and any error encountered during the process.
-// The token is signed using the HS256 signing method and includes the standard claims.
-// The issuer parameter specifies the issuer of the token.
-func GenerateJWT(issuer string) (string, error) {
-	claims := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{
-		Issuer:    issuer,
-		ExpiresAt: time.Now().Add(time.Hour * 24).Unix(),
-	})
-	return claims.SignedString([]byte(SecretKey))
+// Claims are the claims carried by an access token.
+// The issuer holds the user ID and SessionId the session family the token was issued for.
+// RoleIds and PermissionsVersion snapshot the user's roles when the token was issued,
+// which lets the authorization middleware serve permissions from its cache.
+type Claims struct {
+	SessionId          string `json:"sid,omitempty"`
+	RoleIds            []uint `json:"rids,omitempty"`
+	PermissionsVersion uint   `json:"pv,omitempty"`
+	jwt.StandardClaims
 }
 
-// UpdatePassword updates the password of a user.
-// It expects a JSON object containing the new password and password confirmation in the request body.
-// If the passwords do not match, it returns a JSON response with a status code of 400 and an error message.
-// It retrieves the user ID from the JWT cookie and updates the password for the corresponding user in the database.
-// Finally, it returns a JSON response with the updated user object.
-func UpdatePassword(c *fiber.Ctx) error {
-	var data map[string]string
-	if err := c.BodyParser(&data); err != nil {
-		return err
-	}
-	if data["password"] != data["password_confirm"] {
-		c.Status(400)
-		return c.JSON(fiber.Map{
-			"message": "passwords do not match",
-		})
-	}
-	cookie := c.Cookies("jwt")
-	id, _ := ParseJwt(cookie)
-	userId, _ := strconv.Atoi(*id)
-	user := models.User{
-		Id: uint(userId),
-	}
-	user.SetPassword(data["password"])
-	db.Session().Model(&user).Updates(user)
-	return c.JSON(user)
+// GenerateJWT generates a JSON Web Token (JWT) with the specified claims.
+// It returns the generated token as a string and any error encountered during the process.
+// The token is signed with the configured secret using the HS256 signing method and
+// expires after the configured access token TTL.
+func GenerateJWT(claims Claims) (string, error) {
+	now := time.Now()
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(config.Get().Auth.AccessTokenTTL).Unix()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(config.Get().Auth.Secret))
 }
 
-// ParseJwt parses the given JWT token and returns the issuer claim value.
-// It takes a cookie string as input and returns the issuer claim value as a string,
-// along with any error encountered during parsing.
-func ParseJwt(cookie string) (*string, error) {
+// ParseClaims parses and verifies the given JWT token and returns all of its claims.
+func ParseClaims(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(
-		cookie,
-		&jwt.StandardClaims{},
+		tokenString,
+		&Claims{},
 		func(token *jwt.Token) (interface{}, error) {
-			return []byte(SecretKey), nil
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, errors.New("unexpected signing method")
+			}
+			return []byte(config.Get().Auth.Secret), nil
 		})
 
-	if err != nil || !token.Valid {
+	if err != nil {
 		return nil, err
 	}
-	claims := token.Claims.(*jwt.StandardClaims)
-	return &claims.Issuer, nil
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return token.Claims.(*Claims), nil
+}
+
+// UserId returns the ID of the user the token was issued to, as held by the issuer claim.
+func (claims *Claims) UserId() (uint, error) {
+	id, err := strconv.ParseUint(claims.Issuer, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint(id), nil
+}
+
+// claimsKey is the key of the request local that holds the claims of the request's token.
+const claimsKey = "auth.claims"
+
+// SetRequestClaims stores the verified claims of the request's token, so that the handlers and
+// middlewares that run after the authentication read them with RequestClaims instead of parsing the
+// token again.
+func SetRequestClaims(c *fiber.Ctx, claims *Claims) {
+	c.Locals(claimsKey, claims)
+}
+
+// RequestClaims returns the claims stored by SetRequestClaims, or nil for requests that were not
+// authenticated.
+func RequestClaims(c *fiber.Ctx) *Claims {
+	claims, _ := c.Locals(claimsKey).(*Claims)
+	return claims
+}
+
+// TokenFromRequest extracts the session token from the request.
+// A bearer token in the Authorization header takes precedence over the jwt cookie,
+// so that clients without a cookie jar (CLI tools, mobile apps) can authenticate.
+// It returns an empty string if neither is present.
+func TokenFromRequest(c *fiber.Ctx) string {
+	header := c.Get(fiber.HeaderAuthorization)
+	if scheme, token, found := strings.Cut(header, " "); found && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return c.Cookies(CookieName)
 }
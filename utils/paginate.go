@@ -1,35 +1,272 @@
 package utils
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"math"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
 
+	"github.com/lemadane/admin_backend_gofiber/apierror"
 	"github.com/lemadane/admin_backend_gofiber/models"
+	"github.com/lemadane/admin_backend_gofiber/repositories"
 
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
 )
 
+// DefaultPerPage is the number of records on a page when the per_page query parameter is absent.
+const DefaultPerPage = 15
+
+// MaxPerPage is the largest number of records that a single page may hold.
+const MaxPerPage = 100
+
+// Page is one page of entities of type T, as returned by Paginate.
+type Page[T any] struct {
+	Data []T       `json:"data"`
+	Meta fiber.Map `json:"meta"`
+}
+
+// sortKey is one column of a sort order.
+type sortKey struct {
+	field *schema.Field
+	desc  bool
+}
+
 // Paginate is a utility function that retrieves paginated data from the database.
-// It takes a *gorm.DB instance, an entity model, and a page number as input.
-// It returns a fiber.Map containing the paginated data and metadata.
-// The data field in the fiber.Map contains the paginated data retrieved from the database.
-// The meta field in the fiber.Map contains metadata about the pagination, including the total number of records,
-// the current page number, and the last page number.
-// The limit for each page is set to 15 records.
-// The offset is calculated based on the page number and limit.
-func Paginate(db *gorm.DB, entity models.Entity, pageNum int) fiber.Map {
-	limit := 15
-	offset := (pageNum - 1) * limit
-
-	data := entity.Take(db, limit, offset)
-	total := entity.Count(db)
-
-	return fiber.Map{
-		"data": data,
-		"meta": fiber.Map{
-			"total":     total,
-			"page":      pageNum,
-			"last_page": int(math.Ceil(float64(total) / float64(limit))),
-		},
+// It takes the request, a *gorm.DB instance, the repository of the entities and the scope restricting the visible records.
+// The scope is applied to both the data and the total, so that the metadata only counts records the caller may see,
+// and so are the filters in the query parameters, as described by Filter.
+// It returns a Page containing the paginated data and metadata.
+// The Data field of the Page contains the paginated data retrieved from the database.
+// The Meta field of the Page contains metadata about the pagination, including the total number of records,
+// the current page number, the number of records per page and the last page number.
+//
+// The page is selected by the following query parameters:
+//
+//	page      the page number, starting at 1
+//	per_page  the number of records per page, DefaultPerPage by default and at most MaxPerPage
+//	sort      a comma-separated list of columns, each descending if prefixed with "-", e.g. "-created_at,email";
+//	          only the entity's SortFields are accepted, and the entity's DefaultSort applies when it is absent
+//	cursor    the next_cursor of a previous page, which selects the records that follow it instead of page
+//
+// Records are always ordered by ID last, so that the order, and with it every page, is deterministic.
+// Cursors select the next records by their sort values rather than by offset, so that paging through a
+// large or changing table neither slows down nor skips records; a cursor is only valid with the sort it was
+// returned with. The meta field contains next_cursor whenever more records follow, and no page number when
+// a cursor was used. Links to the first, previous, next and last pages are set in the Link header.
+// It returns a 422 API error for an invalid page, per_page or sort, and a 400 API error for a malformed cursor.
+func Paginate[T any](context *fiber.Ctx, db *gorm.DB, repository *repositories.Repository[T], scope models.Scope) (Page[T], error) {
+	var page Page[T]
+	entity := repository.Entity()
+	fields := map[string]string{}
+	pageNum, err := strconv.Atoi(context.Query("page", "1"))
+	if err != nil || pageNum < 1 {
+		fields["page"] = "must be a positive integer"
+	}
+	perPage, err := strconv.Atoi(context.Query("per_page", strconv.Itoa(DefaultPerPage)))
+	if err != nil || perPage < 1 || perPage > MaxPerPage {
+		fields["per_page"] = fmt.Sprintf("must be an integer between 1 and %d", MaxPerPage)
+	}
+	keys, err := parseSort(db, entity, context.Query("sort", entity.DefaultSort()))
+	if err != nil {
+		fields["sort"] = err.Error()
+	}
+	if len(fields) > 0 {
+		return page, apierror.Validation(fields)
+	}
+	filter, err := Filter(context, entity)
+	if err != nil {
+		return page, err
+	}
+	restricted := func(tx *gorm.DB) *gorm.DB {
+		return tx.Scopes(scope, filter)
+	}
+	cursor := context.Query("cursor")
+	var after []interface{}
+	if cursor != "" {
+		if after, err = decodeCursor(keys, cursor); err != nil {
+			return page, apierror.BadRequest("invalid cursor")
+		}
+	}
+
+	ordered := func(tx *gorm.DB) *gorm.DB {
+		tx = tx.Scopes(restricted)
+		if after != nil {
+			tx = tx.Where(keyset(keys, after))
+		}
+		for _, key := range keys {
+			tx = tx.Order(clause.OrderByColumn{Column: column(key), Desc: key.desc})
+		}
+		return tx
+	}
+	offset := (pageNum - 1) * perPage
+	if after != nil {
+		offset = 0
+	}
+	// One more record than requested is taken to tell whether another page follows.
+	data, err := repository.List(db, ordered, perPage+1, offset)
+	if err != nil {
+		return page, err
+	}
+	more := len(data) > perPage
+	if more {
+		data = data[:perPage]
+	}
+	total, err := repository.Count(db, restricted)
+	if err != nil {
+		return page, err
+	}
+	lastPage := int(math.Ceil(float64(total) / float64(perPage)))
+
+	meta := fiber.Map{
+		"total":     total,
+		"per_page":  perPage,
+		"last_page": lastPage,
+	}
+	links := []string{pageLink(context, map[string]string{"page": "1"}), "first"}
+	if after == nil {
+		meta["page"] = pageNum
+		if pageNum > 1 {
+			links = append(links, pageLink(context, map[string]string{"page": strconv.Itoa(pageNum - 1)}), "prev")
+		}
+	}
+	if more {
+		next, err := encodeCursor(context, keys, reflect.ValueOf(data[len(data)-1]))
+		if err != nil {
+			return page, err
+		}
+		meta["next_cursor"] = next
+		if after != nil {
+			links = append(links, pageLink(context, map[string]string{"cursor": next}), "next")
+		} else {
+			links = append(links, pageLink(context, map[string]string{"page": strconv.Itoa(pageNum + 1)}), "next")
+		}
+	}
+	if lastPage > 0 {
+		links = append(links, pageLink(context, map[string]string{"page": strconv.Itoa(lastPage)}), "last")
+	}
+	context.Links(links...)
+
+	page.Data = data
+	page.Meta = meta
+	return page, nil
+}
+
+// parseSort parses a sort query parameter into the sort order of entity, validated against its SortFields.
+// The ID is appended as the last key unless the order already contains it.
+func parseSort(db *gorm.DB, entity models.Entity, sort string) ([]sortKey, error) {
+	statement := &gorm.Statement{DB: db}
+	if err := statement.Parse(entity); err != nil {
+		return nil, err
+	}
+	allowed := map[string]bool{}
+	for _, column := range entity.SortFields() {
+		allowed[column] = true
+	}
+	keys := make([]sortKey, 0)
+	seen := map[string]bool{}
+	for _, part := range strings.Split(sort, ",") {
+		column := strings.TrimPrefix(strings.TrimSpace(part), "-")
+		field := statement.Schema.LookUpField(column)
+		if !allowed[column] || field == nil {
+			return nil, fmt.Errorf("cannot sort by %q; allowed are %s", column, strings.Join(entity.SortFields(), ", "))
+		}
+		if seen[column] {
+			return nil, fmt.Errorf("%q is given more than once", column)
+		}
+		seen[column] = true
+		keys = append(keys, sortKey{
+			field: field,
+			desc:  strings.HasPrefix(strings.TrimSpace(part), "-"),
+		})
+	}
+	if !seen["id"] {
+		keys = append(keys, sortKey{field: statement.Schema.PrioritizedPrimaryField})
+	}
+	return keys, nil
+}
+
+// keyset returns the condition that selects the records following the one with the given sort values:
+// those that sort after it on the first key, or are equal on the first key and sort after it on the
+// second, and so on.
+func keyset(keys []sortKey, values []interface{}) clause.Expression {
+	alternatives := make([]clause.Expression, len(keys))
+	for i, key := range keys {
+		conditions := make([]clause.Expression, 0, i+1)
+		for j := 0; j < i; j++ {
+			conditions = append(conditions, clause.Eq{Column: column(keys[j]), Value: values[j]})
+		}
+		if key.desc {
+			conditions = append(conditions, clause.Lt{Column: column(key), Value: values[i]})
+		} else {
+			conditions = append(conditions, clause.Gt{Column: column(key), Value: values[i]})
+		}
+		alternatives[i] = clause.And(conditions...)
+	}
+	return models.AnyOf(alternatives)
+}
+
+// column returns the column of a sort key, qualified with the table of the query.
+func column(key sortKey) clause.Column {
+	return clause.Column{Table: clause.CurrentTable, Name: key.field.DBName}
+}
+
+// encodeCursor returns the cursor that selects the records following record in the sort order given by keys.
+// It is the URL-safe base64 encoding of the JSON array of the record's sort values.
+func encodeCursor(context *fiber.Ctx, keys []sortKey, record reflect.Value) (string, error) {
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		values[i], _ = key.field.ValueOf(context.Context(), reflect.Indirect(record))
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor returns the sort values encoded in cursor, each converted to the type of its field.
+func decodeCursor(keys []sortKey, cursor string) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if len(raw) != len(keys) {
+		return nil, fmt.Errorf("cursor has %d values for %d sort keys", len(raw), len(keys))
+	}
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		value := reflect.New(key.field.FieldType)
+		if err := json.Unmarshal(raw[i], value.Interface()); err != nil {
+			return nil, err
+		}
+		values[i] = value.Elem().Interface()
+	}
+	return values, nil
+}
+
+// pageLink returns the URL of the request with the given query parameters replaced. Setting page
+// removes the cursor and the other way round, since a cursor takes precedence over a page.
+func pageLink(context *fiber.Ctx, params map[string]string) string {
+	query, _ := url.ParseQuery(string(context.Request().URI().QueryString()))
+	for name, value := range params {
+		query.Set(name, value)
+		switch name {
+		case "page":
+			query.Del("cursor")
+		case "cursor":
+			query.Del("page")
+		}
 	}
+	return context.BaseURL() + context.Path() + "?" + query.Encode()
 }
@@ -0,0 +1,220 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lemadane/admin_backend_gofiber/apierror"
+	"github.com/lemadane/admin_backend_gofiber/db"
+	"github.com/lemadane/admin_backend_gofiber/internal/testdb"
+	"github.com/lemadane/admin_backend_gofiber/models"
+	"github.com/lemadane/admin_backend_gofiber/repositories"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// cursorOf returns the cursor encoding the given sort values.
+func cursorOf(values string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(values))
+}
+
+// links returns the query strings of the links in a Link header, by relation. The links are separated
+// by commas, which the query strings only hold escaped.
+func links(t *testing.T, header string) map[string]string {
+	t.Helper()
+	found := map[string]string{}
+	if header == "" {
+		return found
+	}
+	for _, link := range strings.Split(header, ",") {
+		target, rel, ok := strings.Cut(link, "; rel=")
+		if !ok {
+			t.Fatalf("malformed link %q", link)
+		}
+		parsed, err := url.Parse(strings.Trim(target, "<>"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		found[strings.Trim(rel, `"`)] = parsed.RawQuery
+	}
+	return found
+}
+
+func TestPaginate(t *testing.T) {
+	// The users are created in reverse order of their emails, so that sorting by email reverses them.
+	emails := []string{"e@example.com", "d@example.com", "c@example.com", "b@example.com", "a@example.com"}
+
+	tests := []struct {
+		name  string
+		query string
+		// status is the expected status; the ids and links are only checked for 200.
+		status int
+		ids    []uint
+		links  map[string]string
+	}{
+		{
+			name:   "first page",
+			query:  "per_page=2",
+			status: fiber.StatusOK,
+			ids:    []uint{1, 2},
+			links: map[string]string{
+				"first": "page=1&per_page=2",
+				"next":  "page=2&per_page=2",
+				"last":  "page=3&per_page=2",
+			},
+		},
+		{
+			name:   "middle page",
+			query:  "per_page=2&page=2",
+			status: fiber.StatusOK,
+			ids:    []uint{3, 4},
+			links: map[string]string{
+				"first": "page=1&per_page=2",
+				"prev":  "page=1&per_page=2",
+				"next":  "page=3&per_page=2",
+				"last":  "page=3&per_page=2",
+			},
+		},
+		{
+			name:   "last page",
+			query:  "per_page=2&page=3",
+			status: fiber.StatusOK,
+			ids:    []uint{5},
+			links: map[string]string{
+				"first": "page=1&per_page=2",
+				"prev":  "page=2&per_page=2",
+				"last":  "page=3&per_page=2",
+			},
+		},
+		{
+			name:   "page past the end",
+			query:  "per_page=2&page=4",
+			status: fiber.StatusOK,
+			ids:    []uint{},
+			links: map[string]string{
+				"first": "page=1&per_page=2",
+				"prev":  "page=3&per_page=2",
+				"last":  "page=3&per_page=2",
+			},
+		},
+		{
+			name:   "default page size",
+			query:  "",
+			status: fiber.StatusOK,
+			ids:    []uint{1, 2, 3, 4, 5},
+			links: map[string]string{
+				"first": "page=1",
+				"last":  "page=1",
+			},
+		},
+		{
+			name:   "descending sort",
+			query:  "per_page=2&sort=-id",
+			status: fiber.StatusOK,
+			ids:    []uint{5, 4},
+			links: map[string]string{
+				"first": "page=1&per_page=2&sort=-id",
+				"next":  "page=2&per_page=2&sort=-id",
+				"last":  "page=3&per_page=2&sort=-id",
+			},
+		},
+		{
+			name:   "cursor",
+			query:  "per_page=2&cursor=" + cursorOf("[2]"),
+			status: fiber.StatusOK,
+			ids:    []uint{3, 4},
+			links: map[string]string{
+				"first": "page=1&per_page=2",
+				"next":  "cursor=" + cursorOf("[4]") + "&per_page=2",
+				"last":  "page=3&per_page=2",
+			},
+		},
+		{
+			name:   "cursor of the last page",
+			query:  "per_page=2&cursor=" + cursorOf("[4]"),
+			status: fiber.StatusOK,
+			ids:    []uint{5},
+			links: map[string]string{
+				"first": "page=1&per_page=2",
+				"last":  "page=3&per_page=2",
+			},
+		},
+		{
+			name:   "cursor of a descending sort",
+			query:  "per_page=2&sort=-id&cursor=" + cursorOf("[4]"),
+			status: fiber.StatusOK,
+			ids:    []uint{3, 2},
+			links: map[string]string{
+				"first": "page=1&per_page=2&sort=-id",
+				"next":  "cursor=" + cursorOf("[2]") + "&per_page=2&sort=-id",
+				"last":  "page=3&per_page=2&sort=-id",
+			},
+		},
+		{
+			name:   "cursor of a sort by text",
+			query:  "per_page=2&sort=email&cursor=" + cursorOf(`["b@example.com",4]`),
+			status: fiber.StatusOK,
+			ids:    []uint{3, 2},
+			links: map[string]string{
+				"first": "page=1&per_page=2&sort=email",
+				"next":  "cursor=" + cursorOf(`["d@example.com",2]`) + "&per_page=2&sort=email",
+				"last":  "page=3&per_page=2&sort=email",
+			},
+		},
+		{name: "page zero", query: "page=0", status: fiber.StatusUnprocessableEntity},
+		{name: "page size too large", query: "per_page=101", status: fiber.StatusUnprocessableEntity},
+		{name: "unsortable column", query: "sort=password", status: fiber.StatusUnprocessableEntity},
+		{name: "column sorted twice", query: "sort=email,-email", status: fiber.StatusUnprocessableEntity},
+		{name: "cursor not in base64", query: "cursor=!", status: fiber.StatusBadRequest},
+		{name: "cursor not a list", query: "cursor=" + cursorOf(`{"id":2}`), status: fiber.StatusBadRequest},
+		{name: "cursor of another sort", query: "sort=email&cursor=" + cursorOf("[2]"), status: fiber.StatusBadRequest},
+		{name: "cursor of the wrong type", query: "cursor=" + cursorOf(`["2"]`), status: fiber.StatusBadRequest},
+	}
+
+	testdb.Setup(t)
+	for _, email := range emails {
+		createUser(t, email)
+	}
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.Handler})
+	app.Get("/users", func(context *fiber.Ctx) error {
+		page, err := Paginate(context, db.Session(), repositories.Users, models.Unrestricted)
+		if err != nil {
+			return err
+		}
+		return context.JSON(page)
+	})
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/users?"+test.query, nil), -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer response.Body.Close()
+			if response.StatusCode != test.status {
+				t.Fatalf("status = %d, want %d", response.StatusCode, test.status)
+			}
+			if test.status != fiber.StatusOK {
+				return
+			}
+			var page Page[models.User]
+			if err := json.NewDecoder(response.Body).Decode(&page); err != nil {
+				t.Fatal(err)
+			}
+			ids := make([]uint, len(page.Data))
+			for i, user := range page.Data {
+				ids[i] = user.Id
+			}
+			if !reflect.DeepEqual(ids, test.ids) {
+				t.Errorf("ids = %v, want %v", ids, test.ids)
+			}
+			if got := links(t, response.Header.Get(fiber.HeaderLink)); !reflect.DeepEqual(got, test.links) {
+				t.Errorf("links = %v, want %v", got, test.links)
+			}
+		})
+	}
+}
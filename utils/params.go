@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"strconv"
+
+	"github.com/lemadane/admin_backend_gofiber/apierror"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ParamId parses the named route parameter as a positive resource ID.
+// It returns a 400 API error if the parameter is not a positive integer.
+func ParamId(c *fiber.Ctx, name string) (uint, error) {
+	id, err := strconv.ParseUint(c.Params(name), 10, 32)
+	if err != nil || id == 0 {
+		return 0, apierror.BadRequest("invalid " + name + ": must be a positive integer")
+	}
+	return uint(id), nil
+}
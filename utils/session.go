@@ -0,0 +1,252 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/lemadane/admin_backend_gofiber/authz"
+	"github.com/lemadane/admin_backend_gofiber/config"
+	"github.com/lemadane/admin_backend_gofiber/db"
+	"github.com/lemadane/admin_backend_gofiber/models"
+	"github.com/lemadane/admin_backend_gofiber/ttlmap"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RefreshCookieName is the name of the cookie that carries the refresh token.
+const RefreshCookieName = "refresh_token"
+
+var (
+	// ErrInvalidRefreshToken is returned when a refresh token is unknown, expired or revoked.
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+	// ErrRefreshTokenReused is returned when an already rotated refresh token is presented again.
+	// The whole session family is revoked when this happens.
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// SessionCacheTTL bounds how long the state of a session family is served from memory.
+// Revocations made through this process take effect immediately; the TTL only matters for
+// revocations made by other instances.
+const SessionCacheTTL = time.Minute
+
+// families caches whether session families are active, keyed by family ID.
+var families = ttlmap.New[string, bool](SessionCacheTTL)
+
+// Tokens is a freshly issued access and refresh token pair.
+type Tokens struct {
+	AccessToken      string    `json:"token"`
+	RefreshToken     string    `json:"refresh_token"`
+	AccessExpiresAt  time.Time `json:"-"`
+	RefreshExpiresAt time.Time `json:"-"`
+}
+
+// IssueSession starts a new session family for the user and returns its first token pair.
+// It is called on login.
+func IssueSession(userId uint, userAgent string, ip string) (*Tokens, error) {
+	var tokens *Tokens
+	err := db.Session().Transaction(func(tx *gorm.DB) error {
+		var err error
+		tokens, _, err = createSession(tx, uuid.NewString(), userId, userAgent, ip)
+		return err
+	})
+	return tokens, err
+}
+
+// RotateSession exchanges a refresh token for a new token pair in the same session family.
+// The presented refresh token is revoked. If it had already been rotated, the token has
+// been replayed, so every session in its family is revoked and ErrRefreshTokenReused is returned.
+func RotateSession(refreshToken string, userAgent string, ip string) (*Tokens, error) {
+	var tokens *Tokens
+	var reused bool
+	err := db.Session().Transaction(func(tx *gorm.DB) error {
+		var session models.Session
+		err := tx.Where("token_hash = ?", hashToken(refreshToken)).First(&session).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+		if session.ReplacedById != nil {
+			reused = true
+			return ErrRefreshTokenReused
+		}
+		now := time.Now()
+		if !session.IsActive(now) {
+			return ErrInvalidRefreshToken
+		}
+
+		// Guard against two concurrent refreshes with the same token:
+		// only the one that flips revoked_at gets to issue a new pair.
+		result := tx.Model(&models.Session{}).
+			Where("id = ? AND revoked_at IS NULL", session.Id).
+			Update("revoked_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			reused = true
+			return ErrRefreshTokenReused
+		}
+
+		var next *models.Session
+		tokens, next, err = createSession(tx, session.FamilyId, session.UserId, userAgent, ip)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.Session{}).
+			Where("id = ?", session.Id).
+			Update("replaced_by_id", next.Id).Error
+	})
+	if reused {
+		if err := RevokeRefreshToken(refreshToken); err != nil {
+			return nil, err
+		}
+	}
+	return tokens, err
+}
+
+// RevokeRefreshToken revokes every session in the family of the given refresh token.
+// Unknown tokens are ignored.
+func RevokeRefreshToken(refreshToken string) error {
+	var session models.Session
+	err := db.Session().Where("token_hash = ?", hashToken(refreshToken)).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return RevokeSessionFamily(session.FamilyId)
+}
+
+// RevokeSessionFamily revokes every session that belongs to the given family.
+func RevokeSessionFamily(familyId string) error {
+	err := db.Session().Model(&models.Session{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyId).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		return err
+	}
+	forgetFamilies(familyId)
+	return nil
+}
+
+// RevokeUserSessions revokes every session of the user, except those of the family exceptFamilyId,
+// which may be empty. It runs on tx so that it can be part of the change that requires it, such as
+// deleting the user; the revoked families are rejected at once, even if tx is rolled back later.
+func RevokeUserSessions(tx *gorm.DB, userId uint, exceptFamilyId string) error {
+	query := tx.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", userId)
+	if exceptFamilyId != "" {
+		query = query.Where("family_id <> ?", exceptFamilyId)
+	}
+	var familyIds []string
+	if err := query.Distinct().Pluck("family_id", &familyIds).Error; err != nil {
+		return err
+	}
+	if len(familyIds) == 0 {
+		return nil
+	}
+	err := tx.Model(&models.Session{}).
+		Where("family_id IN ? AND revoked_at IS NULL", familyIds).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		return err
+	}
+	forgetFamilies(familyIds...)
+	return nil
+}
+
+// IsSessionActive reports whether the session family still has a usable session.
+// Access tokens carry their family ID, so revoking the family also invalidates them.
+// The answer is cached for SessionCacheTTL, so that most requests make no query.
+func IsSessionActive(familyId string) bool {
+	if familyId == "" {
+		return false
+	}
+	if active, ok := families.Get(familyId); ok {
+		return active
+	}
+	var count int64
+	err := db.Session().Model(&models.Session{}).
+		Where("family_id = ? AND revoked_at IS NULL AND expires_at > ?", familyId, time.Now()).
+		Count(&count).Error
+	if err != nil {
+		return false
+	}
+	families.Set(familyId, count > 0)
+	return count > 0
+}
+
+// forgetFamilies records that the session families were revoked, so that their access tokens are
+// rejected at once instead of once their cached state expires.
+func forgetFamilies(familyIds ...string) {
+	for _, familyId := range familyIds {
+		families.Set(familyId, false)
+	}
+}
+
+// createSession stores a new session in the given family and signs the matching access token.
+func createSession(tx *gorm.DB, familyId string, userId uint, userAgent string, ip string) (*Tokens, *models.Session, error) {
+	refreshToken, err := randomToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	session := models.Session{
+		FamilyId:  familyId,
+		UserId:    userId,
+		TokenHash: hashToken(refreshToken),
+		UserAgent: userAgent,
+		Ip:        ip,
+		ExpiresAt: now.Add(config.Get().Auth.RefreshTokenTTL),
+	}
+	if err := tx.Create(&session).Error; err != nil {
+		return nil, nil, err
+	}
+	roleIds, permissionsVersion, err := authz.Snapshot(userId)
+	if err != nil {
+		return nil, nil, err
+	}
+	accessToken, err := GenerateJWT(Claims{
+		SessionId:          familyId,
+		RoleIds:            roleIds,
+		PermissionsVersion: permissionsVersion,
+		StandardClaims: jwt.StandardClaims{
+			Issuer: strconv.Itoa(int(userId)),
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &Tokens{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		AccessExpiresAt:  now.Add(config.Get().Auth.AccessTokenTTL),
+		RefreshExpiresAt: session.ExpiresAt,
+	}, &session, nil
+}
+
+// randomToken returns a URL-safe, 256-bit random token.
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken returns the hex-encoded SHA-256 of a refresh token.
+// Only hashes are stored, so a leaked sessions table cannot be replayed.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,183 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lemadane/admin_backend_gofiber/db"
+	"github.com/lemadane/admin_backend_gofiber/internal/testdb"
+	"github.com/lemadane/admin_backend_gofiber/models"
+)
+
+// createUser stores a user with the given email and returns their ID.
+func createUser(t *testing.T, email string) uint {
+	t.Helper()
+	user := models.User{Firstname: "Test", Email: email}
+	if err := db.Session().Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user.Id
+}
+
+// familyOf returns the session family of an access token.
+func familyOf(t *testing.T, tokens *Tokens) string {
+	t.Helper()
+	claims, err := ParseClaims(tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return claims.SessionId
+}
+
+func TestRotateSession(t *testing.T) {
+	tests := []struct {
+		name string
+		// present returns the refresh token to rotate, given the pair issued at login.
+		present func(t *testing.T, login *Tokens) string
+		want    error
+		// active is whether the family of the login is still active afterwards.
+		active bool
+	}{
+		{
+			name:    "rotates the current token",
+			present: func(t *testing.T, login *Tokens) string { return login.RefreshToken },
+			active:  true,
+		},
+		{
+			name: "rotates the token of the previous rotation",
+			present: func(t *testing.T, login *Tokens) string {
+				next, err := RotateSession(login.RefreshToken, "", "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				return next.RefreshToken
+			},
+			active: true,
+		},
+		{
+			name:    "rejects an unknown token",
+			present: func(t *testing.T, login *Tokens) string { return "unknown" },
+			want:    ErrInvalidRefreshToken,
+			active:  true,
+		},
+		{
+			name: "detects the reuse of a rotated token",
+			present: func(t *testing.T, login *Tokens) string {
+				if _, err := RotateSession(login.RefreshToken, "", ""); err != nil {
+					t.Fatal(err)
+				}
+				return login.RefreshToken
+			},
+			want: ErrRefreshTokenReused,
+		},
+		{
+			name: "rejects a revoked token",
+			present: func(t *testing.T, login *Tokens) string {
+				if err := RevokeRefreshToken(login.RefreshToken); err != nil {
+					t.Fatal(err)
+				}
+				return login.RefreshToken
+			},
+			want: ErrInvalidRefreshToken,
+		},
+		{
+			name: "rejects an expired token",
+			present: func(t *testing.T, login *Tokens) string {
+				err := db.Session().Model(&models.Session{}).
+					Where("token_hash = ?", hashToken(login.RefreshToken)).
+					Update("expires_at", time.Now().Add(-time.Second)).Error
+				if err != nil {
+					t.Fatal(err)
+				}
+				return login.RefreshToken
+			},
+			want: ErrInvalidRefreshToken,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testdb.Setup(t)
+			login, err := IssueSession(createUser(t, "ada@example.com"), "test", "127.0.0.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			family := familyOf(t, login)
+
+			tokens, err := RotateSession(test.present(t, login), "test", "127.0.0.1")
+			if !errors.Is(err, test.want) {
+				t.Fatalf("RotateSession() error = %v, want %v", err, test.want)
+			}
+			if test.want == nil {
+				if tokens.RefreshToken == login.RefreshToken {
+					t.Error("RotateSession() returned the presented refresh token")
+				}
+				if got := familyOf(t, tokens); got != family {
+					t.Errorf("RotateSession() family = %q, want %q", got, family)
+				}
+				// The presented token is spent, so presenting it again is a reuse.
+				if _, err := RotateSession(login.RefreshToken, "", ""); !errors.Is(err, ErrRefreshTokenReused) {
+					t.Errorf("second RotateSession() error = %v, want %v", err, ErrRefreshTokenReused)
+				}
+				return
+			}
+			if got := IsSessionActive(family); got != test.active {
+				t.Errorf("IsSessionActive() = %v, want %v", got, test.active)
+			}
+		})
+	}
+}
+
+func TestRevokeUserSessions(t *testing.T) {
+	tests := []struct {
+		name   string
+		except bool
+		// keptActive and otherActive are whether the two families of the user are active afterwards.
+		keptActive  bool
+		otherActive bool
+	}{
+		{name: "revokes every family", keptActive: false, otherActive: false},
+		{name: "keeps the excepted family", except: true, keptActive: true, otherActive: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testdb.Setup(t)
+			userId := createUser(t, "ada@example.com")
+			kept, err := IssueSession(userId, "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			other, err := IssueSession(userId, "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			stranger, err := IssueSession(createUser(t, "bob@example.com"), "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The states are cached first, so that the test also covers their invalidation.
+			for _, tokens := range []*Tokens{kept, other, stranger} {
+				if !IsSessionActive(familyOf(t, tokens)) {
+					t.Fatal("IsSessionActive() = false after login")
+				}
+			}
+
+			except := ""
+			if test.except {
+				except = familyOf(t, kept)
+			}
+			if err := RevokeUserSessions(db.Session(), userId, except); err != nil {
+				t.Fatal(err)
+			}
+			if got := IsSessionActive(familyOf(t, kept)); got != test.keptActive {
+				t.Errorf("kept family active = %v, want %v", got, test.keptActive)
+			}
+			if got := IsSessionActive(familyOf(t, other)); got != test.otherActive {
+				t.Errorf("other family active = %v, want %v", got, test.otherActive)
+			}
+			if !IsSessionActive(familyOf(t, stranger)) {
+				t.Error("the family of another user was revoked")
+			}
+		})
+	}
+}
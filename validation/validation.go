@@ -0,0 +1,199 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/lemadane/admin_backend_gofiber/apierror"
+	"github.com/lemadane/admin_backend_gofiber/db"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// validate is the shared validator instance. It caches struct metadata, so it is created once.
+var validate = newValidator()
+
+// existsTables are the tables that the "exists" rule may look up, to keep raw table
+// names out of anything but this list.
+var existsTables = map[string]bool{
+	"roles":       true,
+	"permissions": true,
+	"users":       true,
+}
+
+// maxPasswordBytes is the length of the longest password that bcrypt can hash. It is a number of bytes,
+// so it allows fewer characters outside of ASCII.
+const maxPasswordBytes = 72
+
+// uniqueColumns are the columns that the "unique" rule may look up, as "table.column".
+var uniqueColumns = map[string]bool{
+	"users.email": true,
+}
+
+// newValidator creates a validator that reports JSON field names and knows the custom rules:
+//
+//	password      at least 8 characters with at least one letter and one digit
+//	bcrypt        at most 72 bytes, the longest password that bcrypt can hash
+//	exists=table  the value is the ID of a row in the given table
+//	unique=table.column  no row of the given table holds the value in the given column
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	if err := v.RegisterValidation("password", isStrongPassword); err != nil {
+		panic(err)
+	}
+	if err := v.RegisterValidation("bcrypt", isBcryptLength); err != nil {
+		panic(err)
+	}
+	if err := v.RegisterValidation("exists", existsInTable); err != nil {
+		panic(err)
+	}
+	if err := v.RegisterValidation("unique", isUniqueInColumn); err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// Parse parses the request body into dto and validates it.
+// It returns a 422 API error with a message for each invalid field.
+func Parse(context *fiber.Ctx, dto interface{}) error {
+	if err := context.BodyParser(dto); err != nil {
+		return err
+	}
+	return Struct(dto)
+}
+
+// Struct validates dto against its `validate` tags.
+// It returns a 422 API error with a message for each invalid field.
+func Struct(dto interface{}) error {
+	err := validate.Struct(dto)
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return err
+	}
+	fields := make(map[string]string, len(validationErrs))
+	for _, fieldErr := range validationErrs {
+		fields[fieldName(fieldErr)] = message(fieldErr)
+	}
+	return apierror.Validation(fields)
+}
+
+// fieldName returns the JSON path of the field without the name of the root struct,
+// e.g. "permissions[2]".
+func fieldName(fieldErr validator.FieldError) string {
+	_, name, found := strings.Cut(fieldErr.Namespace(), ".")
+	if !found {
+		return fieldErr.Field()
+	}
+	return name
+}
+
+// message returns the human-readable message for a failed rule.
+func message(fieldErr validator.FieldError) string {
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "max":
+		if fieldErr.Kind() == reflect.Slice {
+			return fmt.Sprintf("must contain at most %s items", fieldErr.Param())
+		}
+		return fmt.Sprintf("must be at most %s characters", fieldErr.Param())
+	case "min":
+		return fmt.Sprintf("must be at least %s characters", fieldErr.Param())
+	case "password":
+		return "must be at least 8 characters and contain a letter and a digit"
+	case "bcrypt":
+		return fmt.Sprintf("must be at most %d bytes", maxPasswordBytes)
+	case "eqfield":
+		return "must match " + strings.ToLower(fieldErr.Param())
+	case "exists":
+		return "does not exist"
+	case "unique":
+		return "is already taken"
+	case "gt":
+		return "must be greater than " + fieldErr.Param()
+	case "gte":
+		return "must be at least " + fieldErr.Param()
+	case "url":
+		return "must be a valid URL"
+	}
+	return "is invalid"
+}
+
+// isStrongPassword implements the "password" rule.
+func isStrongPassword(fl validator.FieldLevel) bool {
+	password := fl.Field().String()
+	if len(password) < 8 {
+		return false
+	}
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	return hasLetter && hasDigit
+}
+
+// isBcryptLength implements the "bcrypt" rule.
+func isBcryptLength(fl validator.FieldLevel) bool {
+	return len(fl.Field().String()) <= maxPasswordBytes
+}
+
+// existsInTable implements the "exists=table" rule.
+// Zero values are left to "required", so optional references can be omitted.
+func existsInTable(fl validator.FieldLevel) bool {
+	table := fl.Param()
+	if !existsTables[table] {
+		panic(fmt.Sprintf("validation: exists rule used with unknown table %q", table))
+	}
+	if fl.Field().IsZero() {
+		return true
+	}
+	var count int64
+	if err := db.Session().Table(table).Where("id = ?", fl.Field().Interface()).Count(&count).Error; err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// isUniqueInColumn implements the "unique=table.column" rule. It only guards against the common case,
+// since a concurrent request may take the value between the check and the insert; the unique index of
+// the column catches that case.
+func isUniqueInColumn(fl validator.FieldLevel) bool {
+	if !uniqueColumns[fl.Param()] {
+		panic(fmt.Sprintf("validation: unique rule used with unknown column %q", fl.Param()))
+	}
+	table, column, _ := strings.Cut(fl.Param(), ".")
+	var count int64
+	if err := db.Session().Table(table).Where(column+" = ?", fl.Field().Interface()).Count(&count).Error; err != nil {
+		return false
+	}
+	return count == 0
+}
+
+// Taken converts the violation of a unique index into the 422 error that the "unique" rule reports for
+// field, and returns any other error unchanged. It is used where the rule cannot be, such as updates,
+// which may keep the value the row already holds, and where the only unique index written is that of field.
+func Taken(err error, field string) error {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return apierror.Validation(map[string]string{field: "is already taken"})
+	}
+	return err
+}